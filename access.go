@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/s3"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// sessionManagerPreferences is the document Session Manager reads its
+// account-wide preferences, including session logging, from.
+const sessionManagerPreferences = "SSM-SessionManagerRunShell"
+
+// newSessionManagerAccess lets the SSM agent on the instances register with
+// Session Manager and, with session-manager-preferences and
+// session-logs-destination, records every session in CloudWatch Logs or S3.
+// role is the instance role.
+func newSessionManagerAccess(ctx *pulumi.Context, cfg *StackConfig, role *iam.Role, parent pulumi.Resource) error {
+	_, err := iam.NewRolePolicyAttachment(ctx, "ssm-managed-instance-core-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore"),
+	}, childOptions(parent)...)
+	if err != nil {
+		return err
+	}
+
+	// the preferences name either a log group or a bucket, never both
+	logGroupName := pulumi.String("").ToStringOutput()
+	bucketName := pulumi.String("").ToStringOutput()
+	var policy pulumi.StringOutput
+	switch cfg.SessionLogsDestination {
+	case flowLogDestinationCloudWatch:
+		logGroup, err := cloudwatch.NewLogGroup(ctx, "session-manager-log-group", &cloudwatch.LogGroupArgs{
+			Name:            pulumi.String(ctx.Stack() + "-session-manager-logs"),
+			RetentionInDays: pulumi.Int(cfg.SessionLogsRetentionDays),
+		}, childOptions(parent)...)
+		if err != nil {
+			return err
+		}
+		logGroupName = logGroup.Name
+		policy = logGroup.Arn.ApplyT(func(arn string) (string, error) {
+			return policyDocument([]map[string]interface{}{
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"logs:CreateLogStream", "logs:PutLogEvents", "logs:DescribeLogStreams"},
+					"Resource": []string{arn, arn + ":*"},
+				},
+				// the agent checks the group exists before it starts a session
+				{
+					"Effect":   "Allow",
+					"Action":   "logs:DescribeLogGroups",
+					"Resource": "*",
+				},
+			})
+		}).(pulumi.StringOutput)
+
+	case flowLogDestinationS3:
+		bucketArn := pulumi.String(cfg.SessionLogsBucketArn).ToStringOutput()
+		bucketName = pulumi.String(strings.TrimPrefix(cfg.SessionLogsBucketArn, "arn:aws:s3:::")).ToStringOutput()
+		if cfg.SessionLogsBucketArn == "" {
+			bucket, err := s3.NewBucketV2(ctx, "session-manager-log-bucket", &s3.BucketV2Args{
+				BucketPrefix: pulumi.String("session-manager-logs-"),
+				ForceDestroy: pulumi.Bool(true),
+				Tags: pulumi.StringMap{
+					"course": courseTag,
+					"assign": assignmentTag,
+					"Name":   pulumi.String("session-manager-log-bucket"),
+				},
+			}, childOptions(parent)...)
+			if err != nil {
+				return err
+			}
+			_, err = s3.NewBucketPublicAccessBlock(ctx, "session-manager-log-bucket-public-access-block", &s3.BucketPublicAccessBlockArgs{
+				Bucket:                bucket.ID(),
+				BlockPublicAcls:       pulumi.Bool(true),
+				BlockPublicPolicy:     pulumi.Bool(true),
+				IgnorePublicAcls:      pulumi.Bool(true),
+				RestrictPublicBuckets: pulumi.Bool(true),
+			}, childOptions(parent)...)
+			if err != nil {
+				return err
+			}
+			bucketArn = bucket.Arn
+			bucketName = bucket.Bucket
+		}
+		policy = bucketArn.ApplyT(func(arn string) (string, error) {
+			return policyDocument([]map[string]interface{}{
+				{
+					"Effect":   "Allow",
+					"Action":   "s3:PutObject",
+					"Resource": arn + "/*",
+				},
+				{
+					"Effect":   "Allow",
+					"Action":   "s3:GetEncryptionConfiguration",
+					"Resource": arn,
+				},
+			})
+		}).(pulumi.StringOutput)
+
+	default:
+		return nil
+	}
+
+	_, err = iam.NewRolePolicy(ctx, "session-manager-logs-policy", &iam.RolePolicyArgs{
+		Role:   role.ID(),
+		Policy: policy,
+	}, childOptions(parent)...)
+	if err != nil {
+		return err
+	}
+
+	_, err = ssm.NewDocument(ctx, "session-manager-preferences", &ssm.DocumentArgs{
+		Name:           pulumi.String(sessionManagerPreferences),
+		DocumentType:   pulumi.String("Session"),
+		DocumentFormat: pulumi.String("JSON"),
+		Content: pulumi.All(logGroupName, bucketName).ApplyT(func(v []interface{}) (string, error) {
+			content, err := json.Marshal(map[string]interface{}{
+				"schemaVersion": "1.0",
+				"description":   "Session Manager preferences of the csye6225 instances",
+				"sessionType":   "Standard_Stream",
+				"inputs": map[string]interface{}{
+					"cloudWatchLogGroupName":      v[0].(string),
+					"cloudWatchEncryptionEnabled": false,
+					"cloudWatchStreamingEnabled":  true,
+					"s3BucketName":                v[1].(string),
+					"s3KeyPrefix":                 "",
+					"s3EncryptionEnabled":         true,
+					"runAsEnabled":                false,
+				},
+			})
+			return string(content), err
+		}).(pulumi.StringOutput),
+	}, childOptions(parent)...)
+	return err
+}
+
+// policyDocument wraps statements in an IAM policy document.
+func policyDocument(statements []map[string]interface{}) (string, error) {
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	})
+	return string(policy), err
+}
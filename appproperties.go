@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// defaultAppProperties are the application.properties defaults of each
+// app-environment, before app-properties is applied. dev lets Hibernate update
+// the schema; prod only validates it, so a boot never changes the production
+// schema. Neither uses create-drop, which would wipe the database whenever an
+// instance boots.
+var defaultAppProperties = map[string]map[string]string{
+	appEnvironmentDev: {
+		"spring.jpa.hibernate.ddl-auto":              "update",
+		"spring.jpa.show-sql":                        "true",
+		"logging.level.org.springframework.security": "info",
+		"application.config.csv-file":                "${USERS_CSV:users.csv}",
+	},
+	appEnvironmentProd: {
+		"spring.jpa.hibernate.ddl-auto":              "validate",
+		"spring.jpa.show-sql":                        "false",
+		"logging.level.org.springframework.security": "warn",
+		"application.config.csv-file":                "${USERS_CSV:users.csv}",
+	},
+}
+
+// derivedAppProperties are set from the database configuration, the region
+// and the submissions topic, and may not appear in app-properties.
+var derivedAppProperties = map[string]bool{
+	"spring.datasource.url":             true,
+	"spring.datasource.username":        true,
+	"spring.datasource.password":        true,
+	"application.datasource.reader-url": true,
+	"application.aws.region":            true,
+	"application.sns.topic-arn":         true,
+}
+
+// appProperty is one line of application.properties.
+type appProperty struct {
+	Key   string
+	Value string
+}
+
+// appProperties merges the environment defaults, the engine's driver and
+// dialect and app-properties, sorted by key. An empty value in
+// app-properties removes the key. The JDBC URLs, password, region and topic
+// ARN are only known on the instance and are added by the boot script.
+func appProperties(cfg *StackConfig) []appProperty {
+	merged := map[string]string{}
+	for k, v := range defaultAppProperties[cfg.AppEnvironment] {
+		merged[k] = v
+	}
+	engine := dbEngineProfiles[cfg.DbEngine]
+	merged["spring.datasource.username"] = cfg.DbMasterUser
+	merged["spring.datasource.driver-class-name"] = engine.JdbcDriver
+	merged["spring.jpa.properties.hibernate.dialect"] = engine.HibernateDialect
+	for k, v := range cfg.AppProperties {
+		if v == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	props := make([]appProperty, 0, len(merged))
+	for k, v := range merged {
+		props = append(props, appProperty{Key: k, Value: v})
+	}
+	sort.Slice(props, func(i, j int) bool { return props[i].Key < props[j].Key })
+	return props
+}
+
+// propertyLine is the application.properties line setting key to value, both
+// escaped the way java.util.Properties.store escapes them, so a value cannot
+// end the line early or add a property of its own.
+func propertyLine(key, value string) string {
+	return escapeProperty(key, true) + "=" + escapeProperty(value, false)
+}
+
+// escapeProperty escapes backslashes, separators, comment characters and
+// control characters, and every space of a key but only a leading space of a
+// value. Anything outside printable ASCII becomes a \uXXXX escape.
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case strings.ContainsRune(`\=:#!`, r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > '~':
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// readerJdbcUrl is the URL the application sends read-only queries to. With
+// several readers, connections are balanced across them.
+func readerJdbcUrl(engine string, endpoints []string, dbName string) string {
+	if len(endpoints) == 1 {
+		return jdbcUrl(engine, endpoints[0], dbName)
+	}
+	profile := dbEngineProfiles[engine]
+	return fmt.Sprintf("jdbc:%s://%s/%s%s", profile.JdbcLoadBalanceScheme, strings.Join(endpoints, ","), dbName, profile.JdbcLoadBalanceQuery)
+}
+
+// jdbcUrl is the datasource URL of the database at endpoint (host:port).
+func jdbcUrl(engine, endpoint, dbName string) string {
+	return fmt.Sprintf("jdbc:%s://%s/%s", dbEngineProfiles[engine].JdbcScheme, endpoint, dbName)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppProperties(t *testing.T) {
+	props := appProperties(&StackConfig{
+		AppEnvironment: appEnvironmentProd,
+		DbEngine:       "postgres",
+		DbMasterUser:   "webapp",
+		AppProperties: map[string]string{
+			"spring.jpa.hibernate.ddl-auto": "none",
+			"application.config.csv-file":   "",
+			"server.port":                   "8080",
+		},
+	})
+
+	got := map[string]string{}
+	for i, p := range props {
+		if i > 0 && props[i-1].Key >= p.Key {
+			t.Errorf("properties are not sorted: %s before %s", props[i-1].Key, p.Key)
+		}
+		got[p.Key] = p.Value
+	}
+	for key, want := range map[string]string{
+		"spring.jpa.hibernate.ddl-auto":           "none",
+		"spring.jpa.show-sql":                     "false",
+		"spring.datasource.username":              "webapp",
+		"spring.datasource.driver-class-name":     "org.postgresql.Driver",
+		"spring.jpa.properties.hibernate.dialect": "org.hibernate.dialect.PostgreSQLDialect",
+		"server.port":                             "8080",
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %q", key, got[key], want)
+		}
+	}
+	if _, ok := got["application.config.csv-file"]; ok {
+		t.Error("an empty override did not remove application.config.csv-file")
+	}
+
+	for env, want := range map[string]string{appEnvironmentDev: "update", appEnvironmentProd: "validate"} {
+		if got := defaultAppProperties[env]["spring.jpa.hibernate.ddl-auto"]; got != want {
+			t.Errorf("%s ddl-auto = %q, want %q", env, got, want)
+		}
+	}
+
+	if url := jdbcUrl("postgres", "db.example.internal:5432", "csye6225"); url != "jdbc:postgresql://db.example.internal:5432/csye6225" {
+		t.Errorf("jdbcUrl() = %s", url)
+	}
+}
+
+func TestAppPropertiesConfig(t *testing.T) {
+	m := mustRunStack(t, map[string]string{"app-environment": "prod", "app-properties": `{"server.port": "8080"}`})
+	m.resource(t, "webapp-launch-template", "aws:ec2/launchTemplate:LaunchTemplate")
+
+	for key, value := range map[string]string{
+		"app-properties":  `{"spring.datasource.password": "hunter22"}`,
+		"app-environment": "staging",
+		"db-engine-name":  "oracle-ee",
+	} {
+		if _, err := runStack(t, map[string]string{key: value}); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s = %s: error = %v, want it rejected", key, value, err)
+		}
+	}
+}
+
+func TestPropertyLine(t *testing.T) {
+	tests := []struct{ key, value, want string }{
+		{"server.port", "8080", `server.port=8080`},
+		{"spring.datasource.url", "jdbc:mariadb://db:3306/app", `spring.datasource.url=jdbc\:mariadb\://db\:3306/app`},
+		{"app.banner", `C:\temp a=b`, `app.banner=C\:\\temp a\=b`},
+		{"app.motd", "hi\nspring.datasource.url=evil", `app.motd=hi\nspring.datasource.url\=evil`},
+		{"app.motd", " #!\t\r\f", `app.motd=\ \#\!\t\r\f`},
+		{"app.name", "café 😀", `app.name=caf\u00E9 \uD83D\uDE00`},
+		{"odd key:=", "", `odd\ key\:\==`},
+	}
+	for _, test := range tests {
+		if got := propertyLine(test.key, test.value); got != test.want {
+			t.Errorf("propertyLine(%q, %q) = %s, want %s", test.key, test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Bastion is the SSH jump host in a public subnet that operators use to reach
+// the private instances and the database.
+type Bastion struct {
+	pulumi.ResourceState
+
+	Instance *ec2.Instance
+
+	PublicIp pulumi.StringOutput
+}
+
+// BastionArgs are the inputs to NewBastion.
+type BastionArgs struct {
+	Config *StackConfig
+
+	// SubnetId is the public subnet the bastion runs in.
+	SubnetId        pulumi.StringInput
+	SecurityGroupId pulumi.StringInput
+}
+
+// gravitonInstanceType matches the instance types of Graviton families such as
+// t4g or m6gd, which need an arm64 AMI.
+var gravitonInstanceType = regexp.MustCompile(`^[a-z]+[0-9]+[a-z]*g[a-z]*\.`)
+
+// NewBastion creates the bastion host. Without bastion-ami-id it runs the
+// latest Amazon Linux 2023 AMI for the instance type's architecture.
+func NewBastion(ctx *pulumi.Context, name string, args *BastionArgs, opts ...pulumi.ResourceOption) (*Bastion, error) {
+	bastion := &Bastion{}
+	err := ctx.RegisterComponentResource("csye6225:index:Bastion", name, bastion, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := args.Config
+
+	// a newer AMI should not replace the host, and with it its public IP, on
+	// every update
+	ami := cfg.BastionAmiId
+	instanceOpts := childOptions(bastion)
+	if ami == "" {
+		arch := "x86_64"
+		if gravitonInstanceType.MatchString(cfg.BastionInstanceType) {
+			arch = "arm64"
+		}
+		parameter, err := ssm.LookupParameter(ctx, &ssm.LookupParameterArgs{
+			Name: "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-" + arch,
+		}, pulumi.Parent(bastion))
+		if err != nil {
+			return nil, err
+		}
+		ami = parameter.Value
+		instanceOpts = append(instanceOpts, pulumi.IgnoreChanges([]string{"ami"}))
+	}
+
+	instance, err := ec2.NewInstance(ctx, "bastion-host", &ec2.InstanceArgs{
+		Ami:                      pulumi.String(ami),
+		InstanceType:             pulumi.String(cfg.BastionInstanceType),
+		KeyName:                  pulumi.String(cfg.SshKey),
+		SubnetId:                 args.SubnetId,
+		VpcSecurityGroupIds:      pulumi.StringArray{args.SecurityGroupId},
+		AssociatePublicIpAddress: pulumi.Bool(true),
+		MetadataOptions: &ec2.InstanceMetadataOptionsArgs{
+			HttpTokens: pulumi.String("required"),
+		},
+		RootBlockDevice: &ec2.InstanceRootBlockDeviceArgs{
+			Encrypted: pulumi.Bool(true),
+		},
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("bastion"),
+		},
+	}, instanceOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	bastion.Instance = instance
+	bastion.PublicIp = instance.PublicIp
+
+	err = ctx.RegisterResourceOutputs(bastion, pulumi.Map{
+		"publicIp": bastion.PublicIp,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bastion, nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import "github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+
+var (
+	courseTag     = pulumi.String("CSYE-6225")
+	assignmentTag = pulumi.String("Assign-6")
+)
+
+// childOptions parents a resource to its component and aliases it to the
+// unparented URN it had before the program was split into components, so
+// existing stacks keep their resources instead of replacing them.
+func childOptions(parent pulumi.Resource, opts ...pulumi.ResourceOption) []pulumi.ResourceOption {
+	return append([]pulumi.ResourceOption{
+		pulumi.Parent(parent),
+		pulumi.Aliases([]pulumi.Alias{{NoParent: pulumi.Bool(true)}}),
+	}, opts...)
+}
@@ -0,0 +1,1041 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// StackConfig is the typed view of Pulumi.<stack>.yaml. It is loaded and
+// validated once, before any resource is registered.
+type StackConfig struct {
+	VpcCidr  string
+	IgwRoute string
+	Ipv4Cidr string
+	Ipv6Cidr string
+
+	EnableIpv6 bool
+
+	SubnetPrefixes SubnetPrefixes
+
+	AzCount             int
+	AvailabilityZones   []string
+	AvailabilityZoneIds []string
+
+	NatMode string
+
+	GatewayEndpoints   []string
+	InterfaceEndpoints []string
+
+	FlowLogDestination   string
+	FlowLogTrafficType   string
+	FlowLogFormat        string
+	FlowLogRetentionDays int
+	FlowLogBucketArn     string
+
+	AccessMode      string
+	SshKey          string
+	AmiId           string
+	Ec2InstanceType string
+	Ports           []int
+	AlbPorts        []int
+	AppSubnetTier   string
+
+	// SecurityGroupRules is security-group-rules as configured; use
+	// securityGroupRules for the rules the stack creates.
+	SecurityGroupRules []SecurityGroupRule
+
+	// SessionManagerPreferences lets the stack own the account-wide
+	// SSM-SessionManagerRunShell document; session logging is set there.
+	SessionManagerPreferences bool
+	SessionLogsDestination    string
+	SessionLogsRetentionDays  int
+	SessionLogsBucketArn      string
+
+	Bastion             bool
+	BastionAdminCidrs   []string
+	BastionInstanceType string
+	BastionAmiId        string
+
+	AppEnvironment string
+	AppProperties  map[string]string
+	// AppService is the systemd unit of the web application, restarted when
+	// a managed password rotates.
+	AppService string
+
+	DbEngine          string
+	DbFamily          string
+	DbEngineVersion   string
+	DbPort            int
+	DbInstanceClass   string
+	DbStorageSize     int
+	DbName            string
+	DbMasterUser      string
+	DbMasterPassword  pulumi.StringOutput
+	DbPasswordMode    string
+	DbMode            string
+	DbReadReplicas    int
+	DbParameters      map[string]DbParameter
+	DbLogExports      []string
+	DbAlarms          bool
+	DbAlarmThresholds DbAlarmThresholds
+	AlertEmail        string
+
+	DbProfile             string
+	DbMultiAz             bool
+	DbStorageEncrypted    bool
+	DbKmsKeyArn           string
+	DbBackupRetentionDays int
+	DbBackupWindow        string
+	DbMaintenanceWindow   string
+	DbSkipFinalSnapshot   bool
+	DbDeletionProtection  bool
+	DbPerformanceInsights bool
+	DbMonitoringInterval  int
+
+	// DbRestoreSnapshot, or DbRestoreSource and DbRestoreTime, seed the
+	// database when it is created. DbRestoreTime is RFC 3339; empty means the
+	// latest restorable time.
+	DbRestoreSnapshot string
+	DbRestoreSource   string
+	DbRestoreTime     string
+
+	DomainName string
+
+	LambdaDeploymentPath string
+	LambdaHandler        string
+
+	GcpProjectId        string
+	GcpCloudStorageRole string
+
+	SmtpHost     string
+	SmtpPort     int
+	SmtpUser     string
+	SmtpPassword pulumi.StringOutput
+	SenderEmail  string
+
+	// dbMasterPasswordLength is all validate sees of db-master-password; the
+	// value itself only exists as a secret output. Zero means unset.
+	dbMasterPasswordLength int
+}
+
+// Values accepted for access-mode: SSH with the ssh-key key pair, or Session
+// Manager without a key pair or port 22.
+const (
+	accessModeSsh = "ssh"
+	accessModeSsm = "ssm"
+)
+
+// sessionManagerEndpoints are the interface endpoints Session Manager needs
+// when instances have no other route to AWS.
+var sessionManagerEndpoints = []string{"ssm", "ssmmessages", "ec2messages"}
+
+// Values accepted for nat-mode.
+const (
+	natModeNone   = "none"
+	natModeSingle = "single"
+	natModePerAz  = "per-az"
+)
+
+// DbParameter is one entry of the db-parameters map. ApplyMethod is
+// immediate or pending-reboot; left empty, it is pending-reboot for known
+// static parameters and immediate otherwise. Remove drops one of the engine's
+// own parameters from the group, so RDS's default applies again.
+type DbParameter struct {
+	Value       string `json:"value"`
+	ApplyMethod string `json:"apply-method"`
+	Remove      bool   `json:"remove"`
+}
+
+// DbAlarmThresholds are the limits of the database alarms, read from
+// db-alarm-thresholds. Zero fields take the defaults in loadStackConfig.
+type DbAlarmThresholds struct {
+	CpuPercent         float64 `json:"cpu-percent"`
+	FreeStoragePercent float64 `json:"free-storage-percent"`
+	FreeableMemoryMib  float64 `json:"freeable-memory-mib"`
+	Connections        float64 `json:"connections"`
+	ReplicaLagSeconds  float64 `json:"replica-lag-seconds"`
+}
+
+// Values accepted for db-mode: a single RDS instance, optionally with read
+// replicas, or an Aurora cluster with a writer and db-read-replicas readers.
+const (
+	dbModeInstance = "instance"
+	dbModeAurora   = "aurora"
+)
+
+// Values accepted for db-password-mode. In generated mode the stack generates
+// the master password once and keeps it in a Secrets Manager secret; in config
+// mode it is read from db-master-password and copied into that secret. In
+// managed mode RDS generates the password, keeps it in Secrets Manager and
+// rotates it every seven days. The default is config when db-master-password
+// is set and generated otherwise.
+const (
+	dbPasswordModeGenerated = "generated"
+	dbPasswordModeConfig    = "config"
+	dbPasswordModeManaged   = "managed"
+)
+
+// Values accepted for app-subnet-tier.
+const (
+	appSubnetTierPublic  = "public"
+	appSubnetTierPrivate = "private"
+)
+
+// Values accepted for app-environment, which picks the defaults of the web
+// application's properties.
+const (
+	appEnvironmentDev  = "dev"
+	appEnvironmentProd = "prod"
+)
+
+// dbProfile holds the defaults of one db-profile. The prod values of
+// MultiAz, StorageEncrypted, SkipFinalSnapshot, DeletionProtection and
+// BackupRetentionDays are also the weakest a prod stack may configure.
+type dbProfile struct {
+	InstanceClass       string
+	MultiAz             bool
+	StorageEncrypted    bool
+	BackupRetentionDays int
+	SkipFinalSnapshot   bool
+	DeletionProtection  bool
+	PerformanceInsights bool
+	MonitoringInterval  int
+	Alarms              bool
+}
+
+// dbProfiles are the values accepted for db-profile. dev matches how the
+// database was created before profiles existed, so dev stacks are not
+// replaced.
+var dbProfiles = map[string]dbProfile{
+	appEnvironmentDev: {
+		InstanceClass:       "db.t3.micro",
+		BackupRetentionDays: 1,
+		SkipFinalSnapshot:   true,
+	},
+	appEnvironmentProd: {
+		// Performance Insights does not run on micro and small classes
+		InstanceClass:       "db.t3.medium",
+		MultiAz:             true,
+		StorageEncrypted:    true,
+		BackupRetentionDays: 7,
+		DeletionProtection:  true,
+		PerformanceInsights: true,
+		MonitoringInterval:  60,
+		Alarms:              true,
+	},
+}
+
+// dbMonitoringIntervals are the enhanced monitoring intervals RDS accepts,
+// in seconds; 0 turns enhanced monitoring off.
+var dbMonitoringIntervals = map[int]bool{0: true, 1: true, 5: true, 10: true, 15: true, 30: true, 60: true}
+
+// Values accepted for flow-logs-destination and session-logs-destination; the
+// non-empty ones match the LogDestinationType of an EC2 flow log.
+const (
+	flowLogDestinationNone       = "none"
+	flowLogDestinationCloudWatch = "cloud-watch-logs"
+	flowLogDestinationS3         = "s3"
+)
+
+// logRetentionDays are the retention periods CloudWatch Logs accepts.
+var logRetentionDays = map[int]bool{
+	1: true, 3: true, 5: true, 7: true, 14: true, 30: true, 60: true, 90: true,
+	120: true, 150: true, 180: true, 365: true, 400: true, 545: true, 731: true,
+	1096: true, 1827: true, 2192: true, 2557: true, 2922: true, 3288: true, 3653: true,
+}
+
+// Services that may be listed in vpc-gateway-endpoints and
+// vpc-interface-endpoints.
+var (
+	knownGatewayEndpoints   = map[string]bool{"s3": true, "dynamodb": true}
+	knownInterfaceEndpoints = map[string]bool{
+		"sns": true, "sqs": true, "logs": true, "monitoring": true,
+		"ssm": true, "ssmmessages": true, "ec2messages": true,
+		"secretsmanager": true, "kms": true, "sts": true,
+	}
+)
+
+// knownDbInstanceFamilies lists the RDS instance class families we accept for
+// db-instance-class, e.g. "t3" in "db.t3.micro".
+var knownDbInstanceFamilies = map[string]bool{
+	"t3": true, "t4g": true,
+	"m5": true, "m5d": true, "m6g": true, "m6gd": true, "m6i": true, "m7g": true,
+	"r5": true, "r5b": true, "r5d": true, "r6g": true, "r6gd": true, "r6i": true, "r7g": true,
+	"x2g": true,
+}
+
+var (
+	dbInstanceClassPattern    = regexp.MustCompile(`^db\.([a-z0-9]+)\.([a-z0-9]+)$`)
+	ec2InstanceTypePattern    = regexp.MustCompile(`^[a-z][a-z0-9-]*\.[a-z0-9]+$`)
+	amiIdPattern              = regexp.MustCompile(`^ami-[0-9a-f]{8,17}$`)
+	emailPattern              = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	domainNamePattern         = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+	gcpRolePattern            = regexp.MustCompile(`^roles/[A-Za-z0-9_.]+$`)
+	dbIdentifierPattern       = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	backupWindowPattern       = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]-([01][0-9]|2[0-3]):[0-5][0-9]$`)
+	maintenanceWindowPattern  = regexp.MustCompile(`^(mon|tue|wed|thu|fri|sat|sun):([01][0-9]|2[0-3]):[0-5][0-9]-(mon|tue|wed|thu|fri|sat|sun):([01][0-9]|2[0-3]):[0-5][0-9]$`)
+	kmsKeyArnPattern          = regexp.MustCompile(`^arn:aws[a-z-]*:kms:[a-z0-9-]+:[0-9]{12}:key/[0-9a-f-]+$`)
+	rdsIdentifierPattern      = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+	snapshotIdentifierPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9:-]*$`)
+	snapshotArnPattern        = regexp.MustCompile(`^arn:aws[a-z-]*:rds:[a-z0-9-]+:[0-9]{12}:(snapshot|cluster-snapshot):[A-Za-z][A-Za-z0-9:-]*$`)
+	prefixListIdPattern       = regexp.MustCompile(`^pl-[0-9a-f]{8,17}$`)
+	systemdUnitPattern        = regexp.MustCompile(`^[A-Za-z0-9:_.@-]+$`)
+)
+
+// isSmallDbInstanceClass reports whether class is a micro or small RDS
+// class, which neither Aurora nor Performance Insights runs on.
+func isSmallDbInstanceClass(class string) bool {
+	m := dbInstanceClassPattern.FindStringSubmatch(class)
+	return m != nil && (m[2] == "micro" || m[2] == "small")
+}
+
+// configReader wraps the stack config and records every problem instead of
+// panicking on the first one, so all bad keys are reported together.
+type configReader struct {
+	ctx  *pulumi.Context
+	cfg  *config.Config
+	errs []string
+}
+
+func (r *configReader) fail(key, format string, a ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, a...)))
+}
+
+func (r *configReader) require(key string) string {
+	v, err := r.cfg.Try(key)
+	if err != nil {
+		r.fail(key, "is required")
+	}
+	return v
+}
+
+// getSecret reads an optional sensitive key. The value is only handed out as
+// a secret output, along with its length so it can still be validated. A
+// value stored in plaintext instead of with `pulumi config set --secret` is
+// reported as an error.
+func (r *configReader) getSecret(key string) (pulumi.StringOutput, int) {
+	v, err := r.cfg.Try(key)
+	if err != nil {
+		return pulumi.StringOutput{}, 0
+	}
+	if !r.ctx.IsConfigSecret(r.ctx.Project() + ":" + key) {
+		r.fail(key, "must be stored as a secret (pulumi config set --secret %s)", key)
+	}
+	return r.cfg.RequireSecret(key), len(v)
+}
+
+func (r *configReader) requireSecret(key string) pulumi.StringOutput {
+	v, n := r.getSecret(key)
+	if n == 0 {
+		r.fail(key, "is required")
+	}
+	return v
+}
+
+func (r *configReader) get(key, def string) string {
+	if v := r.cfg.Get(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func (r *configReader) getInt(key string, def int) int {
+	v, err := r.cfg.Try(key)
+	if err != nil {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		r.fail(key, "%q is not an integer", v)
+		return def
+	}
+	return n
+}
+
+func (r *configReader) getBool(key string, def bool) bool {
+	v, err := r.cfg.Try(key)
+	if err != nil {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		r.fail(key, "%q is not a boolean", v)
+		return def
+	}
+	return b
+}
+
+func (r *configReader) getObject(key string, output interface{}) {
+	if _, err := r.cfg.Try(key); err != nil {
+		return
+	}
+	if err := r.cfg.TryObject(key, output); err != nil {
+		r.fail(key, "%v", err)
+	}
+}
+
+// loadStackConfig reads every setting the program needs, fills in defaults
+// and validates the result.
+func loadStackConfig(ctx *pulumi.Context) (*StackConfig, error) {
+	r := &configReader{ctx: ctx, cfg: config.New(ctx, "")}
+
+	c := &StackConfig{
+		VpcCidr:  r.require("vpc-cidr"),
+		IgwRoute: r.get("igw-route", "0.0.0.0/0"),
+		Ipv4Cidr: r.get("ipv4-cidr", "0.0.0.0/0"),
+		Ipv6Cidr: r.get("ipv6-cidr", "::/0"),
+
+		EnableIpv6: r.getBool("enable-ipv6", false),
+
+		SubnetPrefixes: SubnetPrefixes{
+			Public:   r.getInt("public-subnet-prefix", 24),
+			Private:  r.getInt("private-subnet-prefix", 24),
+			Isolated: r.getInt("isolated-subnet-prefix", 0),
+		},
+
+		NatMode: r.get("nat-mode", natModeNone),
+
+		FlowLogDestination:   r.get("flow-logs-destination", flowLogDestinationNone),
+		FlowLogTrafficType:   r.get("flow-logs-traffic-type", "ALL"),
+		FlowLogFormat:        r.get("flow-logs-format", ""),
+		FlowLogRetentionDays: r.getInt("flow-logs-retention-days", 14),
+		FlowLogBucketArn:     r.get("flow-logs-bucket-arn", ""),
+
+		AccessMode:      r.get("access-mode", accessModeSsh),
+		AmiId:           r.require("ami-id"),
+		Ec2InstanceType: r.get("ec2-instance-type", "t2.micro"),
+		AlbPorts:        []int{80, 443},
+		AppSubnetTier:   r.get("app-subnet-tier", appSubnetTierPublic),
+
+		SessionManagerPreferences: r.getBool("session-manager-preferences", false),
+		SessionLogsDestination:    r.get("session-logs-destination", flowLogDestinationNone),
+		SessionLogsRetentionDays:  r.getInt("session-logs-retention-days", 14),
+		SessionLogsBucketArn:      r.get("session-logs-bucket-arn", ""),
+
+		Bastion:             r.getBool("bastion", false),
+		BastionInstanceType: r.get("bastion-instance-type", "t3.nano"),
+		BastionAmiId:        r.get("bastion-ami-id", ""),
+
+		AppEnvironment: r.get("app-environment", appEnvironmentDev),
+		AppService:     r.get("app-service", "csye6225"),
+
+		DbEngine:      r.get("db-engine-name", "mariadb"),
+		DbStorageSize: r.getInt("db-storage-size", 20),
+		DbName:        r.get("db-name", "csye6225"),
+		DbMasterUser:  r.get("db-master-user", "csye6225"),
+
+		DomainName: r.require("domain-name"),
+
+		LambdaDeploymentPath: r.require("lambda-deployment-path"),
+		LambdaHandler:        r.get("lambda-handler", "lambda_handler.lambda_handler"),
+
+		GcpProjectId:        r.require("gcp-project-id"),
+		GcpCloudStorageRole: r.get("gcp-cloud-storage-role", "roles/storage.admin"),
+
+		SmtpHost:     r.require("smtp-host"),
+		SmtpPort:     r.getInt("smtp-port", 587),
+		SmtpUser:     r.require("smtp-user"),
+		SmtpPassword: r.requireSecret("smtp-password"),
+		SenderEmail:  r.require("sender-email"),
+	}
+	// Session Manager needs neither the key pair nor port 22
+	if c.AccessMode == accessModeSsm {
+		c.SshKey = r.get("ssh-key", "")
+		c.Ports = []int{8080}
+	} else {
+		c.SshKey = r.require("ssh-key")
+		c.Ports = []int{22, 8080}
+	}
+	r.getObject("availability-zones", &c.AvailabilityZones)
+	r.getObject("availability-zone-ids", &c.AvailabilityZoneIds)
+	defaultAzCount := legacyAzCount
+	if n := len(c.AvailabilityZones) + len(c.AvailabilityZoneIds); n > 0 {
+		defaultAzCount = n
+	}
+	c.AzCount = r.getInt("az-count", defaultAzCount)
+	r.getObject("vpc-gateway-endpoints", &c.GatewayEndpoints)
+	r.getObject("vpc-interface-endpoints", &c.InterfaceEndpoints)
+	r.getObject("ports", &c.Ports)
+	r.getObject("bastion-admin-cidrs", &c.BastionAdminCidrs)
+	r.getObject("alb-ports", &c.AlbPorts)
+	r.getObject("security-group-rules", &c.SecurityGroupRules)
+	if len(c.SecurityGroupRules) > 0 {
+		for _, key := range []string{"ports", "alb-ports"} {
+			if r.cfg.Get(key) != "" {
+				r.fail(key, "is replaced by security-group-rules; remove it")
+			}
+		}
+	}
+	for i := range c.SecurityGroupRules {
+		rule := &c.SecurityGroupRules[i]
+		if (rule.Protocol == ruleProtocolTcp || rule.Protocol == ruleProtocolUdp) && rule.ToPort == 0 {
+			rule.ToPort = rule.FromPort
+		}
+	}
+	r.getObject("app-properties", &c.AppProperties)
+	r.getObject("db-parameters", &c.DbParameters)
+
+	c.DbMasterPassword, c.dbMasterPasswordLength = r.getSecret("db-master-password")
+	// a stack that sets db-master-password keeps using it: generating a new
+	// one would change the live password under the running instances
+	defaultPasswordMode := dbPasswordModeGenerated
+	if c.dbMasterPasswordLength > 0 {
+		defaultPasswordMode = dbPasswordModeConfig
+	}
+	c.DbPasswordMode = r.get("db-password-mode", defaultPasswordMode)
+
+	// the database profile defaults to the application environment and fills
+	// in every setting that is not configured explicitly
+	c.DbProfile = r.get("db-profile", c.AppEnvironment)
+	profile := dbProfiles[c.DbProfile]
+	c.DbInstanceClass = r.get("db-instance-class", profile.InstanceClass)
+	c.DbMultiAz = r.getBool("db-multi-az", profile.MultiAz)
+	c.DbStorageEncrypted = r.getBool("db-storage-encrypted", profile.StorageEncrypted)
+	c.DbKmsKeyArn = r.get("db-kms-key-arn", "")
+	c.DbBackupRetentionDays = r.getInt("db-backup-retention-days", profile.BackupRetentionDays)
+	c.DbBackupWindow = r.get("db-backup-window", "")
+	c.DbMaintenanceWindow = r.get("db-maintenance-window", "")
+	c.DbSkipFinalSnapshot = r.getBool("db-skip-final-snapshot", profile.SkipFinalSnapshot)
+	c.DbDeletionProtection = r.getBool("db-deletion-protection", profile.DeletionProtection)
+	c.DbPerformanceInsights = r.getBool("db-performance-insights", profile.PerformanceInsights)
+	c.DbMonitoringInterval = r.getInt("db-monitoring-interval", profile.MonitoringInterval)
+	c.DbRestoreSnapshot = r.get("db-restore-snapshot", "")
+	c.DbRestoreSource = r.get("db-restore-source", "")
+	c.DbRestoreTime = r.get("db-restore-time", "")
+	c.DbAlarms = r.getBool("db-alarms", profile.Alarms)
+	c.AlertEmail = r.get("alert-email", "")
+	r.getObject("db-log-exports", &c.DbLogExports)
+	r.getObject("db-alarm-thresholds", &c.DbAlarmThresholds)
+	thresholds := &c.DbAlarmThresholds
+	for _, t := range []struct {
+		value *float64
+		def   float64
+	}{
+		{&thresholds.CpuPercent, 80},
+		{&thresholds.FreeStoragePercent, 10},
+		{&thresholds.FreeableMemoryMib, 64},
+		{&thresholds.Connections, 100},
+		{&thresholds.ReplicaLagSeconds, 60},
+	} {
+		if *t.value == 0 {
+			*t.value = t.def
+		}
+	}
+
+	// the version, family and port default to what the engine needs
+	c.DbMode = r.get("db-mode", dbModeInstance)
+	c.DbReadReplicas = r.getInt("db-read-replicas", 0)
+	engine := dbEngineProfiles[c.DbEngine]
+	defaultVersion := engine.DefaultVersion
+	if c.DbMode == dbModeAurora {
+		defaultVersion = engine.AuroraDefaultVersion
+	}
+	c.DbEngineVersion = r.get("db-engine-version", defaultVersion)
+	c.DbPort = r.getInt("db-port", engine.Port)
+	if family := r.get("db-family", ""); family != "" {
+		c.DbFamily = family
+	} else if family, err := parameterGroupFamily(c.DbEngine, c.DbEngineVersion, c.DbMode == dbModeAurora); err == nil {
+		c.DbFamily = family
+	}
+
+	r.errs = append(r.errs, c.validate()...)
+	if len(r.errs) > 0 {
+		return nil, newConfigError(r.errs)
+	}
+	return c, nil
+}
+
+// rdsEngine is the engine name RDS knows the database by: db-engine-name, or
+// its Aurora flavour with db-mode aurora.
+func (c *StackConfig) rdsEngine() string {
+	if c.DbMode == dbModeAurora {
+		return dbEngineProfiles[c.DbEngine].AuroraEngine
+	}
+	return c.DbEngine
+}
+
+// newConfigError folds a list of problems into a single error, one per line.
+func newConfigError(problems []string) error {
+	seen := map[string]bool{}
+	var unique []string
+	for _, p := range problems {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+	return errors.New("invalid stack configuration:\n  " + strings.Join(unique, "\n  "))
+}
+
+// validate checks formats and ranges and returns one message per bad key.
+// Keys that are empty are skipped; missing required keys are reported by the
+// loader.
+func (c *StackConfig) validate() []string {
+	var errs []string
+	fail := func(key, format string, a ...interface{}) {
+		errs = append(errs, fmt.Sprintf("%s: %s", key, fmt.Sprintf(format, a...)))
+	}
+
+	if c.VpcCidr != "" {
+		if ip, _, err := net.ParseCIDR(c.VpcCidr); err != nil || ip.To4() == nil {
+			fail("vpc-cidr", "%q is not a valid IPv4 CIDR block", c.VpcCidr)
+		}
+	}
+	validatePrefix := func(key string, prefix int, optional bool) {
+		if optional && prefix == 0 {
+			return
+		}
+		if prefix < 16 || prefix > 28 {
+			fail(key, "/%d is outside the /16-/28 range AWS allows for subnets", prefix)
+		}
+	}
+	validatePrefix("public-subnet-prefix", c.SubnetPrefixes.Public, false)
+	validatePrefix("private-subnet-prefix", c.SubnetPrefixes.Private, false)
+	validatePrefix("isolated-subnet-prefix", c.SubnetPrefixes.Isolated, true)
+	if c.AzCount < 1 || c.AzCount > maxAzCount {
+		fail("az-count", "must be between 1 and %d, got %d", maxAzCount, c.AzCount)
+	}
+	if len(c.AvailabilityZones) > 0 && len(c.AvailabilityZoneIds) > 0 {
+		fail("availability-zones", "cannot be combined with availability-zone-ids")
+	}
+	if n := len(c.AvailabilityZones) + len(c.AvailabilityZoneIds); n > 0 && c.AzCount > n {
+		fail("az-count", "is %d but only %d zones are listed", c.AzCount, n)
+	}
+	switch c.NatMode {
+	case natModeNone, natModeSingle, natModePerAz:
+	default:
+		fail("nat-mode", "%q must be one of %s, %s or %s", c.NatMode, natModeNone, natModeSingle, natModePerAz)
+	}
+	validateEndpoints := func(key string, services []string, known map[string]bool) {
+		seen := map[string]bool{}
+		for _, service := range services {
+			if !known[service] {
+				fail(key, "unsupported service %q", service)
+			}
+			if seen[service] {
+				fail(key, "%q is listed twice", service)
+			}
+			seen[service] = true
+		}
+	}
+	validateEndpoints("vpc-gateway-endpoints", c.GatewayEndpoints, knownGatewayEndpoints)
+	validateEndpoints("vpc-interface-endpoints", c.InterfaceEndpoints, knownInterfaceEndpoints)
+	switch c.FlowLogDestination {
+	case flowLogDestinationNone, flowLogDestinationS3:
+	case flowLogDestinationCloudWatch:
+		if !logRetentionDays[c.FlowLogRetentionDays] {
+			fail("flow-logs-retention-days", "%d is not a retention period CloudWatch Logs supports", c.FlowLogRetentionDays)
+		}
+	default:
+		fail("flow-logs-destination", "%q must be one of %s, %s or %s", c.FlowLogDestination, flowLogDestinationNone, flowLogDestinationCloudWatch, flowLogDestinationS3)
+	}
+	switch c.FlowLogTrafficType {
+	case "ALL", "ACCEPT", "REJECT":
+	default:
+		fail("flow-logs-traffic-type", "%q must be ALL, ACCEPT or REJECT", c.FlowLogTrafficType)
+	}
+	if c.FlowLogBucketArn != "" && !strings.HasPrefix(c.FlowLogBucketArn, "arn:aws:s3:::") {
+		fail("flow-logs-bucket-arn", "%q is not an S3 bucket ARN", c.FlowLogBucketArn)
+	}
+	if ip, _, err := net.ParseCIDR(c.IgwRoute); err != nil || ip.To4() == nil {
+		fail("igw-route", "%q is not a valid IPv4 CIDR block", c.IgwRoute)
+	}
+	if ip, _, err := net.ParseCIDR(c.Ipv4Cidr); err != nil || ip.To4() == nil {
+		fail("ipv4-cidr", "%q is not a valid IPv4 CIDR block", c.Ipv4Cidr)
+	}
+	if ip, _, err := net.ParseCIDR(c.Ipv6Cidr); err != nil || ip.To4() != nil {
+		fail("ipv6-cidr", "%q is not a valid IPv6 CIDR block", c.Ipv6Cidr)
+	}
+
+	if c.AmiId != "" && !amiIdPattern.MatchString(c.AmiId) {
+		fail("ami-id", "%q is not an AMI id", c.AmiId)
+	}
+	if !ec2InstanceTypePattern.MatchString(c.Ec2InstanceType) {
+		fail("ec2-instance-type", "%q is not an EC2 instance type", c.Ec2InstanceType)
+	}
+	validatePorts := func(key string, ports []int) {
+		if len(ports) == 0 {
+			fail(key, "must list at least one port")
+		}
+		for _, p := range ports {
+			if p < 1 || p > 65535 {
+				fail(key, "port %d is outside 1-65535", p)
+			}
+		}
+	}
+	switch c.AppSubnetTier {
+	case appSubnetTierPublic:
+	case appSubnetTierPrivate:
+		if c.NatMode == natModeNone && len(c.InterfaceEndpoints) == 0 {
+			fail("app-subnet-tier", "private instances need egress; set nat-mode to %s or %s, or configure vpc-interface-endpoints", natModeSingle, natModePerAz)
+		} else if c.NatMode == natModeNone && !slices.Contains(c.InterfaceEndpoints, "secretsmanager") {
+			// the boot script reads the database password from Secrets Manager
+			fail("vpc-interface-endpoints", "private instances without a NAT gateway need secretsmanager to read the database password")
+		}
+	default:
+		fail("app-subnet-tier", "%q must be %s or %s", c.AppSubnetTier, appSubnetTierPublic, appSubnetTierPrivate)
+	}
+	validatePorts("ports", c.Ports)
+	validatePorts("alb-ports", c.AlbPorts)
+	switch c.AccessMode {
+	case accessModeSsh:
+		if c.SessionLogsDestination != flowLogDestinationNone {
+			fail("session-logs-destination", "requires access-mode %s", accessModeSsm)
+		}
+		if c.SessionManagerPreferences {
+			fail("session-manager-preferences", "requires access-mode %s", accessModeSsm)
+		}
+	case accessModeSsm:
+		if c.SshKey != "" {
+			fail("ssh-key", "must not be set with access-mode %s", accessModeSsm)
+		}
+		for _, p := range c.Ports {
+			if p == 22 {
+				fail("ports", "port 22 must not be opened with access-mode %s", accessModeSsm)
+			}
+		}
+		// the agent reaches Session Manager through a NAT gateway or endpoints
+		if c.AppSubnetTier == appSubnetTierPrivate && c.NatMode == natModeNone {
+			for _, service := range sessionManagerEndpoints {
+				if !slices.Contains(c.InterfaceEndpoints, service) {
+					fail("vpc-interface-endpoints", "private instances without a NAT gateway need %s for Session Manager", service)
+				}
+			}
+		}
+		// the preferences are shared by every stack in the account and region,
+		// so the stack only takes them over when asked to
+		if c.SessionLogsDestination != flowLogDestinationNone && !c.SessionManagerPreferences {
+			fail("session-logs-destination", "requires session-manager-preferences; session logging is set in the account-wide %s document", sessionManagerPreferences)
+		}
+		switch c.SessionLogsDestination {
+		case flowLogDestinationNone, flowLogDestinationS3:
+		case flowLogDestinationCloudWatch:
+			if !logRetentionDays[c.SessionLogsRetentionDays] {
+				fail("session-logs-retention-days", "%d is not a retention period CloudWatch Logs supports", c.SessionLogsRetentionDays)
+			}
+		default:
+			fail("session-logs-destination", "%q must be one of %s, %s or %s", c.SessionLogsDestination, flowLogDestinationNone, flowLogDestinationCloudWatch, flowLogDestinationS3)
+		}
+	default:
+		fail("access-mode", "%q must be %s or %s", c.AccessMode, accessModeSsh, accessModeSsm)
+	}
+	if c.Bastion {
+		if c.AccessMode != accessModeSsh {
+			fail("bastion", "requires access-mode %s; Session Manager reaches private instances without one", accessModeSsh)
+		}
+		if len(c.SecurityGroupRules) > 0 {
+			if len(c.BastionAdminCidrs) > 0 {
+				fail("bastion-admin-cidrs", "is replaced by security-group-rules; remove it")
+			}
+		} else if len(c.BastionAdminCidrs) == 0 {
+			fail("bastion-admin-cidrs", "must list the CIDR blocks allowed to reach the bastion")
+		}
+		for _, cidr := range c.BastionAdminCidrs {
+			if _, ipNet, err := net.ParseCIDR(cidr); err != nil {
+				fail("bastion-admin-cidrs", "%q is not a CIDR block", cidr)
+			} else if ones, _ := ipNet.Mask.Size(); ones == 0 {
+				fail("bastion-admin-cidrs", "%q opens the bastion to the whole internet", cidr)
+			}
+		}
+		if !ec2InstanceTypePattern.MatchString(c.BastionInstanceType) {
+			fail("bastion-instance-type", "%q is not an EC2 instance type", c.BastionInstanceType)
+		}
+		if c.BastionAmiId != "" && !amiIdPattern.MatchString(c.BastionAmiId) {
+			fail("bastion-ami-id", "%q is not an AMI id", c.BastionAmiId)
+		}
+	} else if len(c.BastionAdminCidrs) > 0 {
+		fail("bastion-admin-cidrs", "requires bastion")
+	}
+	groups := map[string]bool{
+		securityGroupLoadBalancer: true,
+		securityGroupApplication:  true,
+		securityGroupDatabase:     true,
+		securityGroupBastion:      c.Bastion,
+	}
+	ruleNames := map[string]bool{}
+	for _, rule := range c.SecurityGroupRules {
+		name := rule.resourceName()
+		if ruleNames[name] {
+			fail("security-group-rules", "%s is defined twice", name)
+		}
+		ruleNames[name] = true
+		if !groups[rule.Group] {
+			fail("security-group-rules", "%s: group %q must be %s, %s, %s, or %s with bastion", name, rule.Group, securityGroupLoadBalancer, securityGroupApplication, securityGroupDatabase, securityGroupBastion)
+		}
+		switch rule.Direction {
+		case ruleDirectionIngress, ruleDirectionEgress:
+		default:
+			fail("security-group-rules", "%s: direction %q must be %s or %s", name, rule.Direction, ruleDirectionIngress, ruleDirectionEgress)
+		}
+		switch rule.Protocol {
+		case ruleProtocolTcp, ruleProtocolUdp:
+			if rule.FromPort < 1 || rule.ToPort > 65535 || rule.FromPort > rule.ToPort {
+				fail("security-group-rules", "%s: ports %d-%d are not a range within 1-65535", name, rule.FromPort, rule.ToPort)
+			}
+		case ruleProtocolIcmp, ruleProtocolIcmpv6:
+			// the ports are the ICMP type and code; -1 matches any
+			if rule.FromPort < -1 || rule.FromPort > 255 || rule.ToPort < -1 || rule.ToPort > 255 {
+				fail("security-group-rules", "%s: ICMP type %d and code %d must be within -1-255", name, rule.FromPort, rule.ToPort)
+			}
+		case ruleProtocolAll:
+			if rule.FromPort != 0 || rule.ToPort != 0 {
+				fail("security-group-rules", "%s: protocol %s takes no ports", name, ruleProtocolAll)
+			}
+		default:
+			fail("security-group-rules", "%s: protocol %q must be one of %s, %s, %s, %s or %s", name, rule.Protocol, ruleProtocolTcp, ruleProtocolUdp, ruleProtocolIcmp, ruleProtocolIcmpv6, ruleProtocolAll)
+		}
+
+		peers := 0
+		if len(rule.CidrBlocks)+len(rule.Ipv6CidrBlocks) > 0 {
+			peers++
+		}
+		if rule.SourceGroup != "" {
+			peers++
+			if !groups[rule.SourceGroup] {
+				fail("security-group-rules", "%s: source-group %q is not a security group of this stack", name, rule.SourceGroup)
+			}
+		}
+		if len(rule.PrefixListIds) > 0 {
+			peers++
+		}
+		if peers != 1 {
+			fail("security-group-rules", "%s: needs exactly one of cidr-blocks and ipv6-cidr-blocks, source-group or prefix-list-ids", name)
+		}
+		for _, cidr := range append(slices.Clone(rule.CidrBlocks), rule.Ipv6CidrBlocks...) {
+			ip, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				fail("security-group-rules", "%s: %q is not a CIDR block", name, cidr)
+				continue
+			}
+			if isIpv4 := ip.To4() != nil; isIpv4 != slices.Contains(rule.CidrBlocks, cidr) {
+				fail("security-group-rules", "%s: %q belongs in the other of cidr-blocks and ipv6-cidr-blocks", name, cidr)
+			}
+			if ones, _ := ipNet.Mask.Size(); ones == 0 && rule.Group == securityGroupBastion && rule.Direction == ruleDirectionIngress {
+				fail("security-group-rules", "%s: %q opens the bastion to the whole internet", name, cidr)
+			}
+		}
+		for _, id := range rule.PrefixListIds {
+			if !prefixListIdPattern.MatchString(id) {
+				fail("security-group-rules", "%s: %q is not a prefix list id", name, id)
+			}
+		}
+		if c.AccessMode == accessModeSsm && rule.Group == securityGroupApplication && rule.Direction == ruleDirectionIngress &&
+			(rule.Protocol == ruleProtocolAll || rule.Protocol == ruleProtocolTcp && rule.FromPort <= 22 && rule.ToPort >= 22) {
+			fail("security-group-rules", "%s: port 22 must not be opened with access-mode %s", name, accessModeSsm)
+		}
+	}
+	if c.SessionLogsBucketArn != "" {
+		if c.SessionLogsDestination != flowLogDestinationS3 {
+			fail("session-logs-bucket-arn", "requires session-logs-destination %s", flowLogDestinationS3)
+		} else if !strings.HasPrefix(c.SessionLogsBucketArn, "arn:aws:s3:::") {
+			fail("session-logs-bucket-arn", "%q is not an S3 bucket ARN", c.SessionLogsBucketArn)
+		}
+	}
+	if c.DbPort < 1150 || c.DbPort > 65535 {
+		fail("db-port", "port %d is outside 1150-65535, the range RDS accepts", c.DbPort)
+	}
+	if _, ok := defaultAppProperties[c.AppEnvironment]; !ok {
+		fail("app-environment", "%q must be %s or %s", c.AppEnvironment, appEnvironmentDev, appEnvironmentProd)
+	}
+	if !systemdUnitPattern.MatchString(c.AppService) {
+		fail("app-service", "%q is not a systemd unit name", c.AppService)
+	}
+	for k := range c.AppProperties {
+		if derivedAppProperties[k] {
+			fail("app-properties", "%s is derived by the stack and cannot be overridden", k)
+		}
+	}
+
+	if m := dbInstanceClassPattern.FindStringSubmatch(c.DbInstanceClass); m == nil {
+		fail("db-instance-class", "%q is not an RDS instance class", c.DbInstanceClass)
+	} else if !knownDbInstanceFamilies[m[1]] {
+		fail("db-instance-class", "unknown instance family %q in %q", m[1], c.DbInstanceClass)
+	}
+	if c.DbPerformanceInsights && isSmallDbInstanceClass(c.DbInstanceClass) {
+		fail("db-performance-insights", "is not supported on %s; use a medium or larger db-instance-class", c.DbInstanceClass)
+	}
+	if c.DbStorageSize <= 0 {
+		fail("db-storage-size", "must be a positive number of GiB, got %d", c.DbStorageSize)
+	}
+	if !dbIdentifierPattern.MatchString(c.DbName) {
+		fail("db-name", "%q must start with a letter and contain only letters, digits and underscores", c.DbName)
+	}
+	if !dbIdentifierPattern.MatchString(c.DbMasterUser) {
+		fail("db-master-user", "%q must start with a letter and contain only letters, digits and underscores", c.DbMasterUser)
+	}
+	switch c.DbPasswordMode {
+	case dbPasswordModeGenerated, dbPasswordModeManaged:
+		if c.dbMasterPasswordLength > 0 {
+			fail("db-master-password", "must not be set when db-password-mode is %s", c.DbPasswordMode)
+		}
+	case dbPasswordModeConfig:
+		if c.dbMasterPasswordLength == 0 {
+			fail("db-master-password", "is required when db-password-mode is %s", dbPasswordModeConfig)
+		} else if c.dbMasterPasswordLength < 8 {
+			fail("db-master-password", "must be at least 8 characters")
+		}
+	default:
+		fail("db-password-mode", "%q must be %s, %s or %s", c.DbPasswordMode, dbPasswordModeGenerated, dbPasswordModeConfig, dbPasswordModeManaged)
+	}
+	if engine, ok := dbEngineProfiles[c.DbEngine]; !ok {
+		fail("db-engine-name", "%q must be mariadb, mysql or postgres", c.DbEngine)
+	} else if c.DbMode == dbModeAurora && engine.AuroraEngine == "" {
+		fail("db-engine-name", "%s has no Aurora flavour; use mysql or postgres with db-mode %s", c.DbEngine, dbModeAurora)
+	} else if c.DbFamily == "" {
+		fail("db-engine-version", "%q does not determine a parameter group family; set db-family", c.DbEngineVersion)
+	} else if !strings.HasPrefix(c.DbFamily, c.rdsEngine()) {
+		fail("db-family", "%q does not match engine %q", c.DbFamily, c.rdsEngine())
+	}
+	for _, name := range sortedKeys(c.DbParameters) {
+		p := c.DbParameters[name]
+		if p.Remove {
+			if _, ok := dbEngineProfiles[c.DbEngine].Parameters[name]; !ok {
+				fail("db-parameters", "%s is not one of the %s engine's parameters and cannot be removed", name, c.DbEngine)
+			}
+			if p.Value != "" || p.ApplyMethod != "" {
+				fail("db-parameters", "%s is removed and takes no value or apply-method", name)
+			}
+			continue
+		}
+		switch p.ApplyMethod {
+		case "", applyMethodPendingReboot:
+		case applyMethodImmediate:
+			if dbEngineProfiles[c.DbEngine].StaticParameters[name] {
+				fail("db-parameters", "%s is static and only applies after a reboot; use apply-method %s", name, applyMethodPendingReboot)
+			}
+		default:
+			fail("db-parameters", "%s: apply-method %q must be %s or %s", name, p.ApplyMethod, applyMethodImmediate, applyMethodPendingReboot)
+		}
+		if p.Value == "" {
+			fail("db-parameters", "%s has no value", name)
+		}
+	}
+	for _, log := range c.DbLogExports {
+		if engine, ok := dbEngineProfiles[c.DbEngine]; ok && !engine.LogExports[log] {
+			fail("db-log-exports", "%s cannot export %q; choose from %s", c.DbEngine, log, strings.Join(sortedKeys(engine.LogExports), ", "))
+		}
+	}
+	if t := c.DbAlarmThresholds; t.CpuPercent > 100 || t.FreeStoragePercent >= 100 {
+		fail("db-alarm-thresholds", "cpu-percent and free-storage-percent must be below 100")
+	} else if t.CpuPercent < 0 || t.FreeStoragePercent < 0 || t.FreeableMemoryMib < 0 || t.Connections < 0 || t.ReplicaLagSeconds < 0 {
+		fail("db-alarm-thresholds", "thresholds must not be negative")
+	}
+	if c.AlertEmail != "" && !emailPattern.MatchString(c.AlertEmail) {
+		fail("alert-email", "%q is not an email address", c.AlertEmail)
+	}
+	switch c.DbMode {
+	case dbModeInstance:
+		if c.DbReadReplicas < 0 || c.DbReadReplicas > 5 {
+			fail("db-read-replicas", "%d is outside 0-5", c.DbReadReplicas)
+		}
+		if c.DbReadReplicas > 0 && c.DbBackupRetentionDays == 0 {
+			fail("db-read-replicas", "read replicas need automated backups; set db-backup-retention-days")
+		}
+	case dbModeAurora:
+		if c.DbReadReplicas < 0 || c.DbReadReplicas > 15 {
+			fail("db-read-replicas", "%d is outside 0-15", c.DbReadReplicas)
+		}
+		if c.DbBackupRetentionDays == 0 {
+			fail("db-backup-retention-days", "must be at least 1 with db-mode %s", dbModeAurora)
+		}
+		// an Aurora cluster is only highly available with a reader to fail over to
+		if c.DbMultiAz && c.DbReadReplicas == 0 {
+			fail("db-read-replicas", "must be at least 1 when db-multi-az is set with db-mode %s", dbModeAurora)
+		}
+		if isSmallDbInstanceClass(c.DbInstanceClass) {
+			fail("db-instance-class", "Aurora does not support %s", c.DbInstanceClass)
+		}
+	default:
+		fail("db-mode", "%q must be %s or %s", c.DbMode, dbModeInstance, dbModeAurora)
+	}
+
+	if profile, ok := dbProfiles[c.DbProfile]; !ok {
+		fail("db-profile", "%q must be %s or %s", c.DbProfile, appEnvironmentDev, appEnvironmentProd)
+	} else if c.DbProfile == appEnvironmentProd {
+		if !c.DbMultiAz {
+			fail("db-multi-az", "must be true with db-profile %s", c.DbProfile)
+		}
+		if !c.DbStorageEncrypted {
+			fail("db-storage-encrypted", "must be true with db-profile %s", c.DbProfile)
+		}
+		if c.DbSkipFinalSnapshot {
+			fail("db-skip-final-snapshot", "must be false with db-profile %s", c.DbProfile)
+		}
+		if !c.DbDeletionProtection {
+			fail("db-deletion-protection", "must be true with db-profile %s", c.DbProfile)
+		}
+		if c.DbBackupRetentionDays < profile.BackupRetentionDays {
+			fail("db-backup-retention-days", "must be at least %d with db-profile %s", profile.BackupRetentionDays, c.DbProfile)
+		}
+	}
+	if c.DbBackupRetentionDays < 0 || c.DbBackupRetentionDays > 35 {
+		fail("db-backup-retention-days", "%d is outside 0-35", c.DbBackupRetentionDays)
+	}
+	if c.DbKmsKeyArn != "" {
+		if !c.DbStorageEncrypted {
+			fail("db-kms-key-arn", "requires db-storage-encrypted")
+		} else if !kmsKeyArnPattern.MatchString(c.DbKmsKeyArn) {
+			fail("db-kms-key-arn", "%q is not a KMS key ARN", c.DbKmsKeyArn)
+		}
+	}
+	if c.DbBackupWindow != "" && !backupWindowPattern.MatchString(c.DbBackupWindow) {
+		fail("db-backup-window", "%q must look like 03:00-04:00 (UTC)", c.DbBackupWindow)
+	}
+	if c.DbMaintenanceWindow != "" && !maintenanceWindowPattern.MatchString(c.DbMaintenanceWindow) {
+		fail("db-maintenance-window", "%q must look like sun:04:30-sun:05:30 (UTC)", c.DbMaintenanceWindow)
+	}
+	if !dbMonitoringIntervals[c.DbMonitoringInterval] {
+		fail("db-monitoring-interval", "%d must be one of 0, 1, 5, 10, 15, 30 or 60", c.DbMonitoringInterval)
+	}
+	if c.DbRestoreSnapshot != "" {
+		// an Aurora cluster restores from a cluster snapshot, an instance from
+		// an instance snapshot
+		snapshotType := "snapshot"
+		if c.DbMode == dbModeAurora {
+			snapshotType = "cluster-snapshot"
+		}
+		if m := snapshotArnPattern.FindStringSubmatch(c.DbRestoreSnapshot); m != nil {
+			if m[1] != snapshotType {
+				fail("db-restore-snapshot", "%q is not a %s, which db-mode %s restores from", c.DbRestoreSnapshot, snapshotType, c.DbMode)
+			}
+		} else if !snapshotIdentifierPattern.MatchString(c.DbRestoreSnapshot) {
+			fail("db-restore-snapshot", "%q is not a snapshot identifier or ARN", c.DbRestoreSnapshot)
+		}
+		if c.DbRestoreSource != "" {
+			fail("db-restore-source", "cannot be combined with db-restore-snapshot")
+		}
+	}
+	if c.DbRestoreSource != "" && !rdsIdentifierPattern.MatchString(c.DbRestoreSource) {
+		fail("db-restore-source", "%q is not a database identifier", c.DbRestoreSource)
+	}
+	if c.DbRestoreTime != "" {
+		if c.DbRestoreSource == "" {
+			fail("db-restore-time", "requires db-restore-source")
+		} else if _, err := time.Parse(time.RFC3339, c.DbRestoreTime); err != nil {
+			fail("db-restore-time", "%q must be an RFC 3339 time such as 2026-01-02T03:04:05Z", c.DbRestoreTime)
+		}
+	}
+
+	if c.DomainName != "" && !domainNamePattern.MatchString(c.DomainName) {
+		fail("domain-name", "%q is not a valid domain name", c.DomainName)
+	}
+	if !gcpRolePattern.MatchString(c.GcpCloudStorageRole) {
+		fail("gcp-cloud-storage-role", "%q is not a GCP role name", c.GcpCloudStorageRole)
+	}
+	if c.SmtpPort < 1 || c.SmtpPort > 65535 {
+		fail("smtp-port", "port %d is outside 1-65535", c.SmtpPort)
+	}
+	if c.SenderEmail != "" && !emailPattern.MatchString(c.SenderEmail) {
+		fail("sender-email", "%q is not an email address", c.SenderEmail)
+	}
+	return errs
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/kms"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/rds"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Database is the RDS instance the web application stores its data in,
+// together with its subnet group and parameter group. With db-mode aurora it
+// is an Aurora cluster instead.
+type Database struct {
+	pulumi.ResourceState
+
+	// Instance and Replicas are set with db-mode instance.
+	Instance *rds.Instance
+	Replicas []*rds.Instance
+	// Cluster and ClusterInstances, the writer first, are set with db-mode
+	// aurora.
+	Cluster          *rds.Cluster
+	ClusterInstances []*rds.ClusterInstance
+
+	// Endpoint is the host:port of the writer.
+	Endpoint pulumi.StringOutput
+	Address  pulumi.StringOutput
+	Port     pulumi.IntOutput
+	// ReaderEndpoints are the host:port of each read replica, or the single
+	// reader endpoint of an Aurora cluster. Empty without readers.
+	ReaderEndpoints pulumi.StringArrayOutput
+
+	// PasswordSecretArn is the Secrets Manager secret holding the master
+	// credentials as JSON with "username" and "password" keys.
+	PasswordSecretArn pulumi.StringOutput
+	// AlertTopicArn is the SNS topic the database alarms notify. It is only
+	// set with db-alarms.
+	AlertTopicArn pulumi.StringOutput
+}
+
+// DatabaseArgs are the inputs to NewDatabase.
+type DatabaseArgs struct {
+	Config *StackConfig
+	// Zones are the availability zones of the subnets; readers are spread
+	// across them, starting with the second.
+	Zones []string
+	// SubnetIds are the subnets of the DB subnet group, normally the private ones.
+	SubnetIds        pulumi.StringArrayInput
+	SecurityGroupIds pulumi.StringArrayInput
+}
+
+// dbSettings are the resources and settings the instance and Aurora modes
+// have in common.
+type dbSettings struct {
+	subnetGroup       *rds.SubnetGroup
+	paramGroup        *rds.ParameterGroup
+	kmsKeyId          pulumi.StringPtrInput
+	monitoringRoleArn pulumi.StringPtrInput
+	// password is nil when RDS manages the master password.
+	password pulumi.StringPtrInput
+}
+
+// NewDatabase creates the RDS instance or Aurora cluster described by
+// args.Config.
+func NewDatabase(ctx *pulumi.Context, name string, args *DatabaseArgs, opts ...pulumi.ResourceOption) (*Database, error) {
+	database := &Database{}
+	err := ctx.RegisterComponentResource("csye6225:index:Database", name, database, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := args.Config
+	settings := &dbSettings{}
+
+	settings.subnetGroup, err = rds.NewSubnetGroup(ctx, "db-subnet-group", &rds.SubnetGroupArgs{
+		SubnetIds: args.SubnetIds,
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("db-subnet-group"),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the engine's defaults and db-parameters; an Aurora cluster takes them
+	// in its cluster parameter group instead
+	var parameters rds.ParameterGroupParameterArray
+	if cfg.DbMode == dbModeInstance {
+		for _, p := range dbParameters(cfg) {
+			parameters = append(parameters, &rds.ParameterGroupParameterArgs{
+				Name:        pulumi.String(p.Name),
+				Value:       pulumi.String(p.Value),
+				ApplyMethod: pulumi.String(p.ApplyMethod),
+			})
+		}
+	}
+
+	settings.paramGroup, err = rds.NewParameterGroup(ctx, "param-group", &rds.ParameterGroupArgs{
+		Family:     pulumi.String(cfg.DbFamily),
+		Parameters: parameters,
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("db-parameter-group"),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DbMode == dbModeInstance {
+		applied, err := rds.GetParameterGroup(ctx, "param-group-applied", settings.paramGroup.ID(), nil, pulumi.Parent(database))
+		if err != nil {
+			return nil, err
+		}
+		warnOnStaticParameterChanges(ctx, cfg, applied.Parameters.ApplyT(func(parameters []rds.ParameterGroupParameter) map[string]string {
+			values := map[string]string{}
+			for _, p := range parameters {
+				values[p.Name] = p.Value
+			}
+			return values
+		}).(pulumi.StringMapOutput))
+	}
+
+	// without a configured key, encrypted stacks get their own rotating key
+	// rather than the shared aws/rds one
+	if cfg.DbStorageEncrypted {
+		if cfg.DbKmsKeyArn != "" {
+			settings.kmsKeyId = pulumi.String(cfg.DbKmsKeyArn)
+		} else {
+			key, err := kms.NewKey(ctx, "db-kms-key", &kms.KeyArgs{
+				Description:          pulumi.String("encrypts the csye6225 database"),
+				EnableKeyRotation:    pulumi.Bool(true),
+				DeletionWindowInDays: pulumi.Int(30),
+				Tags: pulumi.StringMap{
+					"course": courseTag,
+					"assign": assignmentTag,
+					"Name":   pulumi.String("db-kms-key"),
+				},
+			}, childOptions(database)...)
+			if err != nil {
+				return nil, err
+			}
+			settings.kmsKeyId = key.Arn
+		}
+	}
+
+	if cfg.DbMonitoringInterval > 0 {
+		monitoringRole, err := iam.NewRole(ctx, "rds-monitoring-role", &iam.RoleArgs{
+			AssumeRolePolicy: pulumi.String(`{
+				"Version": "2012-10-17",
+				"Statement": [{
+					"Effect": "Allow",
+					"Principal": {"Service": "monitoring.rds.amazonaws.com"},
+					"Action": "sts:AssumeRole"
+				}]
+			}`),
+		}, childOptions(database)...)
+		if err != nil {
+			return nil, err
+		}
+		_, err = iam.NewRolePolicyAttachment(ctx, "rds-monitoring-policy", &iam.RolePolicyAttachmentArgs{
+			Role:      monitoringRole.Name,
+			PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AmazonRDSEnhancedMonitoringRole"),
+		}, childOptions(database)...)
+		if err != nil {
+			return nil, err
+		}
+		settings.monitoringRoleArn = monitoringRole.Arn
+	}
+
+	// generated and config passwords are kept in a secret of our own that
+	// nothing rotates. In managed mode the password never passes through
+	// Pulumi: RDS generates it and rotates it every seven days, and the
+	// instances pick up each new one (see webappUserData).
+	var passwordSecretArn pulumi.StringOutput
+	if cfg.DbPasswordMode != dbPasswordModeManaged {
+		password := cfg.DbMasterPassword
+		if cfg.DbPasswordMode == dbPasswordModeGenerated {
+			// the password lives in the stack state, so it only changes
+			// when the resource is replaced on purpose
+			generated, err := random.NewRandomPassword(ctx, "db-master-password-generated", &random.RandomPasswordArgs{
+				Length: pulumi.Int(32),
+				// nothing RDS rejects or a shell would need quoted
+				Special: pulumi.Bool(false),
+			}, childOptions(database)...)
+			if err != nil {
+				return nil, err
+			}
+			password = generated.Result
+		}
+		secret, err := secretsmanager.NewSecret(ctx, "db-master-password-secret", &secretsmanager.SecretArgs{
+			NamePrefix:  pulumi.String("db-master-password-"),
+			Description: pulumi.String("master credentials of the csye6225 database"),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String("db-master-password-secret"),
+			},
+		}, childOptions(database)...)
+		if err != nil {
+			return nil, err
+		}
+		_, err = secretsmanager.NewSecretVersion(ctx, "db-master-password-secret-version", &secretsmanager.SecretVersionArgs{
+			SecretId: secret.ID(),
+			// the password is a secret output, so the JSON built from it is too
+			SecretString: password.ApplyT(func(password string) (string, error) {
+				credentials, err := json.Marshal(map[string]string{
+					"username": cfg.DbMasterUser,
+					"password": password,
+				})
+				return string(credentials), err
+			}).(pulumi.StringOutput),
+		}, childOptions(database)...)
+		if err != nil {
+			return nil, err
+		}
+		settings.password = password
+		passwordSecretArn = secret.Arn
+	}
+
+	var managedSecretArn pulumi.StringOutput
+	if cfg.DbMode == dbModeAurora {
+		managedSecretArn, err = database.createCluster(ctx, args, settings)
+	} else {
+		managedSecretArn, err = database.createInstance(ctx, args, settings)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DbPasswordMode == dbPasswordModeManaged {
+		passwordSecretArn = managedSecretArn
+	}
+	database.PasswordSecretArn = passwordSecretArn
+
+	if cfg.DbAlarms {
+		if err := database.createAlarms(ctx, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	err = ctx.RegisterResourceOutputs(database, pulumi.Map{
+		"endpoint":          database.Endpoint,
+		"address":           database.Address,
+		"port":              database.Port,
+		"readerEndpoints":   database.ReaderEndpoints,
+		"passwordSecretArn": database.PasswordSecretArn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// createInstance creates the RDS instance and its read replicas. It returns
+// the ARN of the secret RDS keeps the master password in when it manages it.
+func (database *Database) createInstance(ctx *pulumi.Context, args *DatabaseArgs, settings *dbSettings) (pulumi.StringOutput, error) {
+	cfg := args.Config
+
+	instanceArgs := &rds.InstanceArgs{
+		AllocatedStorage:             pulumi.Int(cfg.DbStorageSize),
+		Engine:                       pulumi.String(cfg.DbEngine),
+		EngineVersion:                pulumi.String(cfg.DbEngineVersion),
+		Port:                         pulumi.Int(cfg.DbPort),
+		InstanceClass:                pulumi.String(cfg.DbInstanceClass),
+		DbName:                       pulumi.String(cfg.DbName),
+		Username:                     pulumi.String(cfg.DbMasterUser),
+		MultiAz:                      pulumi.Bool(cfg.DbMultiAz),
+		PubliclyAccessible:           pulumi.Bool(false),
+		DbSubnetGroupName:            settings.subnetGroup.Name,
+		ParameterGroupName:           settings.paramGroup.Name,
+		VpcSecurityGroupIds:          args.SecurityGroupIds,
+		EnabledCloudwatchLogsExports: pulumi.ToStringArray(cfg.DbLogExports),
+		SkipFinalSnapshot:            pulumi.Bool(cfg.DbSkipFinalSnapshot),
+		DeletionProtection:           pulumi.Bool(cfg.DbDeletionProtection),
+		StorageEncrypted:             pulumi.Bool(cfg.DbStorageEncrypted),
+		KmsKeyId:                     settings.kmsKeyId,
+		BackupRetentionPeriod:        pulumi.Int(cfg.DbBackupRetentionDays),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("csye6225"),
+		},
+	}
+	if cfg.DbBackupWindow != "" {
+		instanceArgs.BackupWindow = pulumi.String(cfg.DbBackupWindow)
+	}
+	if cfg.DbMaintenanceWindow != "" {
+		instanceArgs.MaintenanceWindow = pulumi.String(cfg.DbMaintenanceWindow)
+	}
+	if !cfg.DbSkipFinalSnapshot {
+		instanceArgs.FinalSnapshotIdentifier = pulumi.String(finalSnapshotIdentifier(ctx.Stack()))
+	}
+	if settings.password != nil {
+		instanceArgs.Password = settings.password
+	} else {
+		instanceArgs.ManageMasterUserPassword = pulumi.Bool(true)
+	}
+	applyInstanceMonitoring(cfg, settings, instanceArgs)
+
+	// a restored instance takes its database name and master user from the
+	// source; the password is still set, or managed, afterwards
+	if cfg.DbRestoreSnapshot != "" {
+		instanceArgs.SnapshotIdentifier = pulumi.String(cfg.DbRestoreSnapshot)
+	} else if cfg.DbRestoreSource != "" {
+		restore := &rds.InstanceRestoreToPointInTimeArgs{
+			SourceDbInstanceIdentifier: pulumi.String(cfg.DbRestoreSource),
+		}
+		if cfg.DbRestoreTime != "" {
+			restore.RestoreTime = pulumi.String(cfg.DbRestoreTime)
+		} else {
+			restore.UseLatestRestorableTime = pulumi.Bool(true)
+		}
+		instanceArgs.RestoreToPointInTime = restore
+	}
+	if cfg.DbRestoreSnapshot != "" || cfg.DbRestoreSource != "" {
+		instanceArgs.DbName = nil
+		instanceArgs.Username = nil
+	}
+
+	db, err := rds.NewInstance(ctx, "db", instanceArgs, childOptions(database, restoreOnCreateOnly)...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// replicas copy the engine, storage and encryption of their source
+	var readerEndpoints pulumi.StringArray
+	for i := 0; i < cfg.DbReadReplicas; i++ {
+		replicaArgs := &rds.InstanceArgs{
+			ReplicateSourceDb:   db.Identifier,
+			InstanceClass:       pulumi.String(cfg.DbInstanceClass),
+			AvailabilityZone:    pulumi.String(args.Zones[(i+1)%len(args.Zones)]),
+			PubliclyAccessible:  pulumi.Bool(false),
+			ParameterGroupName:  settings.paramGroup.Name,
+			VpcSecurityGroupIds: args.SecurityGroupIds,
+			SkipFinalSnapshot:   pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String(fmt.Sprintf("csye6225-replica-%d", i+1)),
+			},
+		}
+		applyInstanceMonitoring(cfg, settings, replicaArgs)
+		replica, err := rds.NewInstance(ctx, fmt.Sprintf("db-replica-%d", i+1), replicaArgs, childOptions(database)...)
+		if err != nil {
+			return pulumi.StringOutput{}, err
+		}
+		database.Replicas = append(database.Replicas, replica)
+		readerEndpoints = append(readerEndpoints, replica.Endpoint)
+	}
+
+	database.Instance = db
+	database.Endpoint = db.Endpoint
+	database.Address = db.Address
+	database.Port = db.Port
+	database.ReaderEndpoints = readerEndpoints.ToStringArrayOutput()
+	if settings.password != nil {
+		return pulumi.StringOutput{}, nil
+	}
+	return db.MasterUserSecrets.Index(pulumi.Int(0)).SecretArn().Elem(), nil
+}
+
+// createCluster creates the Aurora cluster, its cluster parameter group, the
+// writer and the readers. It returns the ARN of the secret RDS keeps the
+// master password in when it manages it.
+func (database *Database) createCluster(ctx *pulumi.Context, args *DatabaseArgs, settings *dbSettings) (pulumi.StringOutput, error) {
+	cfg := args.Config
+
+	var parameters rds.ClusterParameterGroupParameterArray
+	for _, p := range dbParameters(cfg) {
+		parameters = append(parameters, &rds.ClusterParameterGroupParameterArgs{
+			Name:        pulumi.String(p.Name),
+			Value:       pulumi.String(p.Value),
+			ApplyMethod: pulumi.String(p.ApplyMethod),
+		})
+	}
+	clusterParamGroup, err := rds.NewClusterParameterGroup(ctx, "cluster-param-group", &rds.ClusterParameterGroupArgs{
+		Family:     pulumi.String(cfg.DbFamily),
+		Parameters: parameters,
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("db-cluster-parameter-group"),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	applied, err := rds.GetClusterParameterGroup(ctx, "cluster-param-group-applied", clusterParamGroup.ID(), nil, pulumi.Parent(database))
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+	warnOnStaticParameterChanges(ctx, cfg, applied.Parameters.ApplyT(func(parameters []rds.ClusterParameterGroupParameter) map[string]string {
+		values := map[string]string{}
+		for _, p := range parameters {
+			values[p.Name] = p.Value
+		}
+		return values
+	}).(pulumi.StringMapOutput))
+
+	clusterArgs := &rds.ClusterArgs{
+		Engine:                       pulumi.String(cfg.rdsEngine()),
+		EngineVersion:                pulumi.String(cfg.DbEngineVersion),
+		Port:                         pulumi.Int(cfg.DbPort),
+		DatabaseName:                 pulumi.String(cfg.DbName),
+		MasterUsername:               pulumi.String(cfg.DbMasterUser),
+		DbSubnetGroupName:            settings.subnetGroup.Name,
+		DbClusterParameterGroupName:  clusterParamGroup.Name,
+		VpcSecurityGroupIds:          args.SecurityGroupIds,
+		EnabledCloudwatchLogsExports: pulumi.ToStringArray(cfg.DbLogExports),
+		SkipFinalSnapshot:            pulumi.Bool(cfg.DbSkipFinalSnapshot),
+		DeletionProtection:           pulumi.Bool(cfg.DbDeletionProtection),
+		StorageEncrypted:             pulumi.Bool(cfg.DbStorageEncrypted),
+		KmsKeyId:                     settings.kmsKeyId,
+		BackupRetentionPeriod:        pulumi.Int(cfg.DbBackupRetentionDays),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("csye6225"),
+		},
+	}
+	if cfg.DbBackupWindow != "" {
+		clusterArgs.PreferredBackupWindow = pulumi.String(cfg.DbBackupWindow)
+	}
+	if cfg.DbMaintenanceWindow != "" {
+		clusterArgs.PreferredMaintenanceWindow = pulumi.String(cfg.DbMaintenanceWindow)
+	}
+	if !cfg.DbSkipFinalSnapshot {
+		clusterArgs.FinalSnapshotIdentifier = pulumi.String(finalSnapshotIdentifier(ctx.Stack()))
+	}
+	if settings.password != nil {
+		clusterArgs.MasterPassword = settings.password
+	} else {
+		clusterArgs.ManageMasterUserPassword = pulumi.Bool(true)
+	}
+	if cfg.DbRestoreSnapshot != "" {
+		clusterArgs.SnapshotIdentifier = pulumi.String(cfg.DbRestoreSnapshot)
+	} else if cfg.DbRestoreSource != "" {
+		restore := &rds.ClusterRestoreToPointInTimeArgs{
+			SourceClusterIdentifier: pulumi.String(cfg.DbRestoreSource),
+		}
+		if cfg.DbRestoreTime != "" {
+			restore.RestoreToTime = pulumi.String(cfg.DbRestoreTime)
+		} else {
+			restore.UseLatestRestorableTime = pulumi.Bool(true)
+		}
+		clusterArgs.RestoreToPointInTime = restore
+	}
+	if cfg.DbRestoreSnapshot != "" || cfg.DbRestoreSource != "" {
+		clusterArgs.DatabaseName = nil
+		clusterArgs.MasterUsername = nil
+	}
+
+	cluster, err := rds.NewCluster(ctx, "db-cluster", clusterArgs, childOptions(database, restoreOnCreateOnly)...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// the writer goes in the first zone and the readers in the others
+	for i := 0; i <= cfg.DbReadReplicas; i++ {
+		name := "db-writer"
+		if i > 0 {
+			name = fmt.Sprintf("db-reader-%d", i)
+		}
+		instanceArgs := &rds.ClusterInstanceArgs{
+			ClusterIdentifier:    cluster.ID(),
+			Engine:               pulumi.String(cfg.rdsEngine()),
+			EngineVersion:        pulumi.String(cfg.DbEngineVersion),
+			InstanceClass:        pulumi.String(cfg.DbInstanceClass),
+			AvailabilityZone:     pulumi.String(args.Zones[i%len(args.Zones)]),
+			DbSubnetGroupName:    settings.subnetGroup.Name,
+			DbParameterGroupName: settings.paramGroup.Name,
+			PubliclyAccessible:   pulumi.Bool(false),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String("csye6225-" + strings.TrimPrefix(name, "db-")),
+			},
+		}
+		if cfg.DbPerformanceInsights {
+			instanceArgs.PerformanceInsightsEnabled = pulumi.Bool(true)
+			instanceArgs.PerformanceInsightsRetentionPeriod = pulumi.Int(7)
+			instanceArgs.PerformanceInsightsKmsKeyId = settings.kmsKeyId
+		}
+		if settings.monitoringRoleArn != nil {
+			instanceArgs.MonitoringInterval = pulumi.Int(cfg.DbMonitoringInterval)
+			instanceArgs.MonitoringRoleArn = settings.monitoringRoleArn
+		}
+		instance, err := rds.NewClusterInstance(ctx, name, instanceArgs, childOptions(database)...)
+		if err != nil {
+			return pulumi.StringOutput{}, err
+		}
+		database.ClusterInstances = append(database.ClusterInstances, instance)
+	}
+
+	database.Cluster = cluster
+	database.Endpoint = pulumi.Sprintf("%s:%d", cluster.Endpoint, cluster.Port)
+	database.Address = cluster.Endpoint
+	database.Port = cluster.Port
+	if cfg.DbReadReplicas > 0 {
+		database.ReaderEndpoints = pulumi.StringArray{
+			pulumi.Sprintf("%s:%d", cluster.ReaderEndpoint, cluster.Port),
+		}.ToStringArrayOutput()
+	} else {
+		database.ReaderEndpoints = pulumi.StringArray{}.ToStringArrayOutput()
+	}
+	if settings.password != nil {
+		return pulumi.StringOutput{}, nil
+	}
+	return cluster.MasterUserSecrets.Index(pulumi.Int(0)).SecretArn().Elem(), nil
+}
+
+// restoreOnCreateOnly keeps the restore settings from replacing an existing
+// database: they only seed it when it is created, so adding, changing or
+// removing them later leaves the data alone.
+var restoreOnCreateOnly = pulumi.IgnoreChanges([]string{"snapshotIdentifier", "restoreToPointInTime"})
+
+// applyInstanceMonitoring turns on Performance Insights and enhanced
+// monitoring for an RDS instance as configured.
+func applyInstanceMonitoring(cfg *StackConfig, settings *dbSettings, instanceArgs *rds.InstanceArgs) {
+	if cfg.DbPerformanceInsights {
+		instanceArgs.PerformanceInsightsEnabled = pulumi.Bool(true)
+		instanceArgs.PerformanceInsightsRetentionPeriod = pulumi.Int(7)
+		instanceArgs.PerformanceInsightsKmsKeyId = settings.kmsKeyId
+	}
+	if settings.monitoringRoleArn != nil {
+		instanceArgs.MonitoringInterval = pulumi.Int(cfg.DbMonitoringInterval)
+		instanceArgs.MonitoringRoleArn = settings.monitoringRoleArn
+	}
+}
+
+// warnOnStaticParameterChanges warns about every static parameter whose
+// configured value differs from applied, the parameters of the parameter
+// group as read from AWS. During a preview the group read is the deployed
+// one, so the warnings show what stays pending until the database reboots;
+// during an update it is read after the group changed and nothing differs.
+func warnOnStaticParameterChanges(ctx *pulumi.Context, cfg *StackConfig, applied pulumi.StringMapOutput) {
+	static := dbEngineProfiles[cfg.DbEngine].StaticParameters
+	current := staticDbParameters(cfg)
+	applied.ApplyT(func(applied map[string]string) (interface{}, error) {
+		previous := map[string]string{}
+		for name, value := range applied {
+			if static[name] {
+				previous[name] = value
+			}
+		}
+		for _, change := range staticParameterChanges(previous, current) {
+			if err := ctx.Log.Warn(change+"; it takes effect at the next reboot of the database", nil); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+}
+
+var snapshotIdentifierInvalid = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// finalSnapshotIdentifier names the snapshot RDS takes when the stack's
+// database is deleted. It is stable, so it does not cause a diff on every
+// update, and unique per stack.
+func finalSnapshotIdentifier(stack string) string {
+	stack = strings.Trim(snapshotIdentifierInvalid.ReplaceAllString(stack, "-"), "-")
+	return "csye6225-" + stack + "-final-snapshot"
+}
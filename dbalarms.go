@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sns"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// dbAlarmTarget is one database instance the alarms watch.
+type dbAlarmTarget struct {
+	// name prefixes the alarm resource names, for example db-replica-1.
+	name       string
+	identifier pulumi.StringOutput
+	// replica instances also get a replication lag alarm.
+	replica bool
+}
+
+// dbAlarm is one metric alarm of a dbAlarmTarget.
+type dbAlarm struct {
+	suffix      string
+	metric      string
+	comparison  string
+	threshold   float64
+	description string
+}
+
+// createAlarms creates the db-alerts topic and the CloudWatch alarms of every
+// instance of the database.
+func (database *Database) createAlarms(ctx *pulumi.Context, cfg *StackConfig) error {
+	topic, err := sns.NewTopic(ctx, "db-alerts", &sns.TopicArgs{
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("db-alerts"),
+		},
+	}, childOptions(database)...)
+	if err != nil {
+		return err
+	}
+	database.AlertTopicArn = topic.Arn
+
+	if cfg.AlertEmail != "" {
+		_, err = sns.NewTopicSubscription(ctx, "db-alerts-email", &sns.TopicSubscriptionArgs{
+			Topic:    topic.Arn,
+			Protocol: pulumi.String("email"),
+			Endpoint: pulumi.String(cfg.AlertEmail),
+		}, childOptions(database)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	var targets []dbAlarmTarget
+	if database.Cluster != nil {
+		for i, instance := range database.ClusterInstances {
+			name := "db-writer"
+			if i > 0 {
+				name = fmt.Sprintf("db-reader-%d", i)
+			}
+			targets = append(targets, dbAlarmTarget{name: name, identifier: instance.Identifier, replica: i > 0})
+		}
+	} else {
+		targets = append(targets, dbAlarmTarget{name: "db", identifier: database.Instance.Identifier})
+		for i, replica := range database.Replicas {
+			targets = append(targets, dbAlarmTarget{name: fmt.Sprintf("db-replica-%d", i+1), identifier: replica.Identifier, replica: true})
+		}
+	}
+
+	thresholds := cfg.DbAlarmThresholds
+	for _, target := range targets {
+		alarms := []dbAlarm{
+			{"cpu", "CPUUtilization", "GreaterThanThreshold", thresholds.CpuPercent,
+				fmt.Sprintf("CPU of %s is above %g%%", target.name, thresholds.CpuPercent)},
+			{"freeable-memory", "FreeableMemory", "LessThanThreshold", thresholds.FreeableMemoryMib * 1024 * 1024,
+				fmt.Sprintf("freeable memory of %s is below %g MiB", target.name, thresholds.FreeableMemoryMib)},
+			{"connections", "DatabaseConnections", "GreaterThanThreshold", thresholds.Connections,
+				fmt.Sprintf("%s has more than %g connections", target.name, thresholds.Connections)},
+		}
+		// Aurora storage grows on its own, so only instances watch free space
+		if database.Cluster == nil {
+			freeBytes := float64(cfg.DbStorageSize) * 1024 * 1024 * 1024 * thresholds.FreeStoragePercent / 100
+			alarms = append(alarms, dbAlarm{"free-storage", "FreeStorageSpace", "LessThanThreshold", freeBytes,
+				fmt.Sprintf("free storage of %s is below %g%%", target.name, thresholds.FreeStoragePercent)})
+		}
+		if target.replica {
+			// Aurora reports reader lag in milliseconds, replicas in seconds
+			metric, lag := "ReplicaLag", thresholds.ReplicaLagSeconds
+			if database.Cluster != nil {
+				metric, lag = "AuroraReplicaLag", thresholds.ReplicaLagSeconds*1000
+			}
+			alarms = append(alarms, dbAlarm{"replica-lag", metric, "GreaterThanThreshold", lag,
+				fmt.Sprintf("%s lags more than %g seconds behind", target.name, thresholds.ReplicaLagSeconds)})
+		}
+
+		for _, alarm := range alarms {
+			name := fmt.Sprintf("%s-%s-alarm", target.name, alarm.suffix)
+			_, err := cloudwatch.NewMetricAlarm(ctx, name, &cloudwatch.MetricAlarmArgs{
+				AlarmDescription:   pulumi.String(alarm.description),
+				Namespace:          pulumi.String("AWS/RDS"),
+				MetricName:         pulumi.String(alarm.metric),
+				Dimensions:         pulumi.StringMap{"DBInstanceIdentifier": target.identifier},
+				Statistic:          pulumi.String("Average"),
+				Period:             pulumi.Int(300),
+				EvaluationPeriods:  pulumi.Int(2),
+				ComparisonOperator: pulumi.String(alarm.comparison),
+				Threshold:          pulumi.Float64(alarm.threshold),
+				AlarmActions:       pulumi.Array{topic.Arn},
+				OkActions:          pulumi.Array{topic.Arn},
+				Tags:               pulumi.StringMap{"Name": pulumi.String(name)},
+			}, childOptions(database)...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dbEngineProfile is everything that differs between the database engines
+// the stack supports. It is picked by db-engine-name.
+type dbEngineProfile struct {
+	Port           int
+	DefaultVersion string
+	// FamilyVersionParts is how many leading parts of the engine version
+	// make up the parameter group family: mariadb10.11, mysql8.0, postgres16.
+	FamilyVersionParts int
+
+	// AuroraEngine and AuroraDefaultVersion describe the Aurora flavour of
+	// the engine; AuroraEngine is empty if there is none.
+	AuroraEngine         string
+	AuroraDefaultVersion string
+
+	JdbcScheme       string
+	JdbcDriver       string
+	HibernateDialect string
+	// JdbcLoadBalanceScheme and JdbcLoadBalanceQuery build a JDBC URL that
+	// spreads connections over several hosts.
+	JdbcLoadBalanceScheme string
+	JdbcLoadBalanceQuery  string
+
+	// Parameters are set in the parameter group of every stack using the
+	// engine. All of them are dynamic, so they apply without a reboot.
+	Parameters map[string]string
+	// LogExports are the logs the engine can export to CloudWatch Logs.
+	LogExports map[string]bool
+
+	// StaticParameters are well-known parameters that only take effect
+	// after the database reboots.
+	StaticParameters map[string]bool
+}
+
+// mysqlLogExports are the logs MariaDB and MySQL can export; audit needs the
+// audit plugin in an option group to contain anything.
+var mysqlLogExports = map[string]bool{"audit": true, "error": true, "general": true, "slowquery": true}
+
+// mysqlStaticParameters are the static parameters MariaDB and MySQL share.
+var mysqlStaticParameters = map[string]bool{
+	"innodb_buffer_pool_instances": true,
+	"innodb_log_buffer_size":       true,
+	"innodb_log_file_size":         true,
+	"innodb_read_io_threads":       true,
+	"innodb_write_io_threads":      true,
+	"lower_case_table_names":       true,
+	"performance_schema":           true,
+}
+
+var dbEngineProfiles = map[string]dbEngineProfile{
+	"mariadb": {
+		Port:               3306,
+		DefaultVersion:     "10.11.5",
+		FamilyVersionParts: 2,
+
+		JdbcScheme:            "mariadb",
+		JdbcDriver:            "org.mariadb.jdbc.Driver",
+		HibernateDialect:      "org.hibernate.dialect.MariaDBDialect",
+		JdbcLoadBalanceScheme: "mariadb:loadbalance",
+		Parameters: map[string]string{
+			"character_set_server": "utf8mb4",
+			"collation_server":     "utf8mb4_unicode_ci",
+			"slow_query_log":       "1",
+			"long_query_time":      "1",
+		},
+		LogExports:       mysqlLogExports,
+		StaticParameters: mysqlStaticParameters,
+	},
+	"mysql": {
+		Port:               3306,
+		DefaultVersion:     "8.0.35",
+		FamilyVersionParts: 2,
+
+		AuroraEngine:         "aurora-mysql",
+		AuroraDefaultVersion: "8.0.mysql_aurora.3.05.2",
+
+		JdbcScheme:            "mysql",
+		JdbcDriver:            "com.mysql.cj.jdbc.Driver",
+		HibernateDialect:      "org.hibernate.dialect.MySQLDialect",
+		JdbcLoadBalanceScheme: "mysql:loadbalance",
+		Parameters: map[string]string{
+			"character_set_server": "utf8mb4",
+			"collation_server":     "utf8mb4_unicode_ci",
+			"slow_query_log":       "1",
+			"long_query_time":      "1",
+		},
+		LogExports:       mysqlLogExports,
+		StaticParameters: mysqlStaticParameters,
+	},
+	"postgres": {
+		Port:               5432,
+		DefaultVersion:     "16.1",
+		FamilyVersionParts: 1,
+
+		AuroraEngine:         "aurora-postgresql",
+		AuroraDefaultVersion: "16.1",
+
+		JdbcScheme:            "postgresql",
+		JdbcDriver:            "org.postgresql.Driver",
+		HibernateDialect:      "org.hibernate.dialect.PostgreSQLDialect",
+		JdbcLoadBalanceScheme: "postgresql",
+		JdbcLoadBalanceQuery:  "?loadBalanceHosts=true",
+		Parameters: map[string]string{
+			"log_min_duration_statement": "1000",
+		},
+		LogExports: map[string]bool{"postgresql": true, "upgrade": true},
+		StaticParameters: map[string]bool{
+			"max_connections":           true,
+			"max_locks_per_transaction": true,
+			"max_wal_senders":           true,
+			"max_worker_processes":      true,
+			"shared_buffers":            true,
+			"shared_preload_libraries":  true,
+			"wal_buffers":               true,
+		},
+	},
+}
+
+// Apply methods of a parameter group entry.
+const (
+	applyMethodImmediate     = "immediate"
+	applyMethodPendingReboot = "pending-reboot"
+)
+
+// dbParameter is one entry of the database's parameter group.
+type dbParameter struct {
+	Name        string
+	Value       string
+	ApplyMethod string
+}
+
+// dbParameters merges the engine's parameters with db-parameters, sorted by
+// name, leaving out the ones db-parameters removes. Known static parameters
+// default to pending-reboot, everything else to immediate.
+func dbParameters(cfg *StackConfig) []dbParameter {
+	engine := dbEngineProfiles[cfg.DbEngine]
+	merged := map[string]dbParameter{}
+	for name, value := range engine.Parameters {
+		merged[name] = dbParameter{Name: name, Value: value, ApplyMethod: applyMethodImmediate}
+	}
+	for name, p := range cfg.DbParameters {
+		if p.Remove {
+			delete(merged, name)
+			continue
+		}
+		method := p.ApplyMethod
+		if method == "" {
+			method = applyMethodImmediate
+			if engine.StaticParameters[name] {
+				method = applyMethodPendingReboot
+			}
+		}
+		merged[name] = dbParameter{Name: name, Value: p.Value, ApplyMethod: method}
+	}
+
+	params := make([]dbParameter, 0, len(merged))
+	for _, p := range merged {
+		params = append(params, p)
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+// staticDbParameters are the parameters of the engine's known static ones
+// the parameter group sets, by name.
+func staticDbParameters(cfg *StackConfig) map[string]string {
+	static := map[string]string{}
+	for _, p := range dbParameters(cfg) {
+		if dbEngineProfiles[cfg.DbEngine].StaticParameters[p.Name] {
+			static[p.Name] = p.Value
+		}
+	}
+	return static
+}
+
+// staticParameterChanges describes every static parameter whose value
+// differs between the deployed parameter group and this deployment.
+func staticParameterChanges(previous, current map[string]string) []string {
+	names := map[string]bool{}
+	for name := range previous {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+
+	var changes []string
+	for _, name := range sortedKeys(names) {
+		before := previous[name]
+		after := current[name]
+		if before == after {
+			continue
+		}
+		switch {
+		case before == "":
+			changes = append(changes, fmt.Sprintf("static parameter %s is set to %q", name, after))
+		case after == "":
+			changes = append(changes, fmt.Sprintf("static parameter %s is reset from %q to the engine default", name, before))
+		default:
+			changes = append(changes, fmt.Sprintf("static parameter %s changes from %q to %q", name, before, after))
+		}
+	}
+	return changes
+}
+
+// parameterGroupFamily derives the parameter group family of an engine
+// version, for example mariadb 10.11.5 -> mariadb10.11, or with aurora set
+// mysql 8.0.mysql_aurora.3.05.2 -> aurora-mysql8.0.
+func parameterGroupFamily(engine, version string, aurora bool) (string, error) {
+	profile, ok := dbEngineProfiles[engine]
+	if !ok {
+		return "", fmt.Errorf("unknown engine %q", engine)
+	}
+	if aurora {
+		if profile.AuroraEngine == "" {
+			return "", fmt.Errorf("%s has no Aurora flavour", engine)
+		}
+		engine = profile.AuroraEngine
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) < profile.FamilyVersionParts {
+		return "", fmt.Errorf("version %q of %s needs at least %d parts", version, engine, profile.FamilyVersionParts)
+	}
+	return engine + strings.Join(parts[:profile.FamilyVersionParts], "."), nil
+}
+
+// sortedKeys returns the keys of m in order, so resources built from a map
+// do not change between runs.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParameterGroupFamily(t *testing.T) {
+	for _, tt := range []struct {
+		engine, version string
+		aurora          bool
+		want            string
+	}{
+		{"mariadb", "10.11.5", false, "mariadb10.11"},
+		{"mysql", "8.0.35", false, "mysql8.0"},
+		{"postgres", "16.1", false, "postgres16"},
+		{"mysql", "8.0.mysql_aurora.3.05.2", true, "aurora-mysql8.0"},
+		{"postgres", "16.1", true, "aurora-postgresql16"},
+	} {
+		got, err := parameterGroupFamily(tt.engine, tt.version, tt.aurora)
+		if err != nil || got != tt.want {
+			t.Errorf("parameterGroupFamily(%s, %s, %v) = %s, %v, want %s", tt.engine, tt.version, tt.aurora, got, err, tt.want)
+		}
+	}
+	if _, err := parameterGroupFamily("mysql", "8", false); err == nil {
+		t.Error("a one-part mysql version did not fail")
+	}
+	if _, err := parameterGroupFamily("mariadb", "10.11.5", true); err == nil {
+		t.Error("Aurora MariaDB did not fail")
+	}
+}
+
+func TestDbParameters(t *testing.T) {
+	got := dbParameters(&StackConfig{
+		DbEngine: "postgres",
+		DbParameters: map[string]DbParameter{
+			"shared_buffers":             {Value: "{DBInstanceClassMemory/32768}"},
+			"log_min_duration_statement": {Value: "500"},
+			"work_mem":                   {Value: "8192", ApplyMethod: applyMethodPendingReboot},
+		},
+	})
+	want := []dbParameter{
+		{"log_min_duration_statement", "500", applyMethodImmediate},
+		{"shared_buffers", "{DBInstanceClassMemory/32768}", applyMethodPendingReboot},
+		{"work_mem", "8192", applyMethodPendingReboot},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dbParameters() = %v, want %v", got, want)
+	}
+
+	got = dbParameters(&StackConfig{
+		DbEngine: "mariadb",
+		DbParameters: map[string]DbParameter{
+			"character_set_server": {Remove: true},
+			"collation_server":     {Remove: true},
+			"long_query_time":      {Value: "5"},
+		},
+	})
+	want = []dbParameter{
+		{"long_query_time", "5", applyMethodImmediate},
+		{"slow_query_log", "1", applyMethodImmediate},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dbParameters() with removals = %v, want %v", got, want)
+	}
+}
+
+func TestStaticParameterChanges(t *testing.T) {
+	got := staticParameterChanges(
+		map[string]string{"shared_buffers": "1024", "max_connections": "100"},
+		map[string]string{"shared_buffers": "2048", "wal_buffers": "64"},
+	)
+	want := []string{
+		`static parameter max_connections is reset from "100" to the engine default`,
+		`static parameter shared_buffers changes from "1024" to "2048"`,
+		`static parameter wal_buffers is set to "64"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("staticParameterChanges() = %q, want %q", got, want)
+	}
+	if got := staticParameterChanges(nil, map[string]string{}); len(got) != 0 {
+		t.Errorf("staticParameterChanges() on a first deployment = %q", got)
+	}
+}
@@ -4,7 +4,14 @@ go 1.21
 
 toolchain go1.21.2
 
-require github.com/pulumi/pulumi/sdk/v3 v3.94.2
+require (
+	github.com/c-robinson/iplib v1.0.7
+	github.com/google/uuid v1.4.0
+	github.com/pulumi/pulumi-aws/sdk/v6 v6.6.0
+	github.com/pulumi/pulumi-gcp/sdk/v7 v7.2.1
+	github.com/pulumi/pulumi-random/sdk/v4 v4.8.2
+	github.com/pulumi/pulumi/sdk/v3 v3.94.2
+)
 
 require (
 	dario.cat/mergo v1.0.0 // indirect
@@ -17,7 +24,6 @@ require (
 	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
 	github.com/blang/semver v3.5.1+incompatible // indirect
-	github.com/c-robinson/iplib v1.0.7 // indirect
 	github.com/charmbracelet/bubbles v0.16.1 // indirect
 	github.com/charmbracelet/bubbletea v0.24.2 // indirect
 	github.com/charmbracelet/lipgloss v0.7.1 // indirect
@@ -35,7 +41,6 @@ require (
 	github.com/golang/glog v1.1.0 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
-	github.com/google/uuid v1.4.0 // indirect
 	github.com/grpc-ecosystem/grpc-opentracing v0.0.0-20180507213350-8e809c8a8645 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
@@ -62,9 +67,7 @@ require (
 	github.com/pkg/term v1.1.0 // indirect
 	github.com/pulumi/esc v0.5.6 // indirect
 	github.com/pulumi/pulumi-aws/sdk v1.31.0 // indirect
-	github.com/pulumi/pulumi-aws/sdk/v6 v6.6.0 // indirect
 	github.com/pulumi/pulumi-gcp/sdk/v6 v6.67.1 // indirect
-	github.com/pulumi/pulumi-gcp/sdk/v7 v7.2.1 // indirect
 	github.com/pulumi/pulumi/sdk v1.13.1 // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
@@ -0,0 +1,1246 @@
+package main
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// mocks records every resource the program registers and answers the
+// provider functions it invokes, so the whole stack runs offline.
+type mocks struct {
+	mu        sync.Mutex
+	resources map[string]pulumi.MockResourceArgs
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	m.resources[args.Name] = args
+	m.mu.Unlock()
+
+	outputs := args.Inputs.Copy()
+	switch args.TypeToken {
+	case "aws:ec2/vpc:Vpc":
+		if args.Inputs["assignGeneratedIpv6CidrBlock"].IsBool() && args.Inputs["assignGeneratedIpv6CidrBlock"].BoolValue() {
+			outputs["ipv6CidrBlock"] = resource.NewStringProperty("2600:1f18:abcd:ef00::/56")
+		}
+	case "aws:rds/instance:Instance":
+		port := 3306.0
+		if args.Inputs["port"].IsNumber() {
+			port = args.Inputs["port"].NumberValue()
+		}
+		outputs["identifier"] = resource.NewStringProperty(args.Name)
+		outputs["address"] = resource.NewStringProperty(args.Name + ".example.internal")
+		outputs["endpoint"] = resource.NewStringProperty(fmt.Sprintf("%s.example.internal:%d", args.Name, int(port)))
+		outputs["port"] = resource.NewNumberProperty(port)
+	case "random:index/randomPassword:RandomPassword":
+		outputs["result"] = resource.NewStringProperty(strings.Repeat("x", int(args.Inputs["length"].NumberValue())))
+	case "aws:rds/cluster:Cluster":
+		outputs["endpoint"] = resource.NewStringProperty("db-cluster.cluster-mock.example.internal")
+		outputs["readerEndpoint"] = resource.NewStringProperty("db-cluster.cluster-ro-mock.example.internal")
+	}
+	if args.Inputs["manageMasterUserPassword"].IsBool() && args.Inputs["manageMasterUserPassword"].BoolValue() {
+		outputs["masterUserSecrets"] = resource.NewArrayProperty([]resource.PropertyValue{
+			resource.NewObjectProperty(resource.PropertyMap{
+				"secretArn": resource.NewStringProperty("arn:aws:secretsmanager:us-east-1:123456789012:secret:rds!db-mock"),
+			}),
+		})
+	}
+	outputs["arn"] = resource.NewStringProperty("arn:aws:mock:us-east-1:123456789012:" + args.Name)
+	return args.Name + "-id", outputs, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	switch args.Token {
+	case "aws:index/getAvailabilityZones:getAvailabilityZones":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"names":   []interface{}{"us-east-1a", "us-east-1b", "us-east-1c", "us-east-1d"},
+			"zoneIds": []interface{}{"use1-az1", "use1-az2", "use1-az4", "use1-az6"},
+		}), nil
+	case "aws:index/getCallerIdentity:getCallerIdentity":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"accountId": "123456789012"}), nil
+	case "aws:index/getPartition:getPartition":
+		// not "aws", so an ARN with a hardcoded partition shows up in tests
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"partition": "aws-us-gov", "dnsSuffix": "amazonaws.com"}), nil
+	case "aws:index/getRegion:getRegion":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"name": "us-east-1"}), nil
+	case "aws:acm/getCertificate:getCertificate":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"arn": "arn:aws:acm:us-east-1:123456789012:certificate/mock",
+		}), nil
+	case "aws:ssm/getParameter:getParameter":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"value": "ami-0123456789abcdef0"}), nil
+	case "aws:route53/getZone:getZone":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"id": "Z0MOCK", "name": "demo.example.com"}), nil
+	case "aws:iam/getPolicyDocument:getPolicyDocument":
+		// echo the statements so tests can inspect what a policy grants
+		document, err := json.Marshal(args.Args.Mappable())
+		if err != nil {
+			return nil, err
+		}
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"json": string(document)}), nil
+	}
+	return nil, fmt.Errorf("unexpected call %s", args.Token)
+}
+
+// testConfig is a complete, valid stack configuration.
+func testConfig() map[string]string {
+	return map[string]string{
+		"vpc-cidr":               "10.0.0.0/16",
+		"ssh-key":                "demo-key",
+		"ami-id":                 "ami-013eb60208aac6f83",
+		"domain-name":            "demo.example.com",
+		"lambda-deployment-path": "lambda.zip",
+		"gcp-project-id":         "test-project",
+		"smtp-host":              "smtp.example.com",
+		"smtp-user":              "postmaster@example.com",
+		"smtp-password":          "smtp-secret",
+		"sender-email":           "noreply@example.com",
+	}
+}
+
+// testSecretKeys are the keys runStack marks as set with --secret.
+var testSecretKeys = []string{"db-master-password", "smtp-password"}
+
+// runStack runs createStack against mocks with testConfig plus overrides. A
+// value of "" removes the key.
+func runStack(t *testing.T, overrides map[string]string) (*mocks, error) {
+	t.Helper()
+	return runStackWithSecretKeys(t, overrides, testSecretKeys)
+}
+
+// runStackWithSecretKeys is runStack with an explicit list of keys that are
+// stored as secrets.
+func runStackWithSecretKeys(t *testing.T, overrides map[string]string, secretKeys []string) (*mocks, error) {
+	t.Helper()
+
+	values := testConfig()
+	for k, v := range overrides {
+		if v == "" {
+			delete(values, k)
+		} else {
+			values[k] = v
+		}
+	}
+	cfg := map[string]string{}
+	for k, v := range values {
+		cfg["iac-pulumi:"+k] = v
+	}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(pulumi.EnvConfig, string(raw))
+	var secrets []string
+	for _, k := range secretKeys {
+		secrets = append(secrets, "iac-pulumi:"+k)
+	}
+	raw, err = json.Marshal(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(pulumi.EnvConfigSecretKeys, string(raw))
+
+	m := &mocks{resources: map[string]pulumi.MockResourceArgs{}}
+	err = pulumi.RunErr(createStack, pulumi.WithMocks("iac-pulumi", "test", m))
+	return m, err
+}
+
+func mustRunStack(t *testing.T, overrides map[string]string) *mocks {
+	t.Helper()
+	m, err := runStack(t, overrides)
+	if err != nil {
+		t.Fatalf("stack failed: %v", err)
+	}
+	return m
+}
+
+// resource returns the inputs of the named resource, failing the test if it
+// was not registered with the expected type.
+func (m *mocks) resource(t *testing.T, name, typ string) resource.PropertyMap {
+	t.Helper()
+	args, ok := m.resources[name]
+	if !ok {
+		t.Fatalf("resource %q was not created", name)
+	}
+	if args.TypeToken != typ {
+		t.Fatalf("resource %q has type %s, want %s", name, args.TypeToken, typ)
+	}
+	return args.Inputs
+}
+
+func (m *mocks) has(name string) bool {
+	_, ok := m.resources[name]
+	return ok
+}
+
+// securityGroupRules returns the inputs of the rules of one direction that
+// belong to the named security group, whether standalone or inline. Inline
+// rules get the peer group in sourceSecurityGroupId, as standalone ones have it.
+func (m *mocks) securityGroupRules(group, direction string) []resource.PropertyMap {
+	var rules []resource.PropertyMap
+	for _, args := range m.resources {
+		if args.TypeToken == "aws:ec2/securityGroupRule:SecurityGroupRule" &&
+			stringInput(args.Inputs, "securityGroupId") == group+"-id" && stringInput(args.Inputs, "type") == direction {
+			rules = append(rules, args.Inputs)
+		}
+	}
+	if sg, ok := m.resources[group]; ok && direction == "ingress" {
+		for _, v := range arrayInput(sg.Inputs, "ingress") {
+			rule := v.ObjectValue().Copy()
+			if groups := arrayInput(rule, "securityGroups"); len(groups) == 1 {
+				rule["sourceSecurityGroupId"] = groups[0]
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// standaloneIngress returns the names of the standalone ingress rules.
+func (m *mocks) standaloneIngress() []string {
+	var names []string
+	for name, args := range m.resources {
+		if args.TypeToken == "aws:ec2/securityGroupRule:SecurityGroupRule" && stringInput(args.Inputs, "type") == "ingress" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func stringInput(props resource.PropertyMap, key string) string {
+	v, ok := props[resource.PropertyKey(key)]
+	if !ok || !v.IsString() {
+		return ""
+	}
+	return v.StringValue()
+}
+
+func arrayInput(props resource.PropertyMap, key string) []resource.PropertyValue {
+	v, ok := props[resource.PropertyKey(key)]
+	if !ok || !v.IsArray() {
+		return nil
+	}
+	return v.ArrayValue()
+}
+
+func TestSubnetCidrs(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	want := map[string]string{
+		"public-subnet-1":  "10.0.0.0/24",
+		"public-subnet-2":  "10.0.1.0/24",
+		"public-subnet-3":  "10.0.2.0/24",
+		"private-subnet-1": "10.0.3.0/24",
+		"private-subnet-2": "10.0.4.0/24",
+		"private-subnet-3": "10.0.5.0/24",
+	}
+	for name, cidr := range want {
+		subnet := m.resource(t, name, "aws:ec2/subnet:Subnet")
+		if got := stringInput(subnet, "cidrBlock"); got != cidr {
+			t.Errorf("%s cidrBlock = %s, want %s", name, got, cidr)
+		}
+	}
+	if m.has("public-subnet-4") {
+		t.Error("created a fourth public subnet with the default az-count of 3")
+	}
+	if az := stringInput(m.resource(t, "private-subnet-2", "aws:ec2/subnet:Subnet"), "availabilityZone"); az != "us-east-1b" {
+		t.Errorf("private-subnet-2 availabilityZone = %s, want us-east-1b", az)
+	}
+}
+
+func TestAzCountAndZoneIds(t *testing.T) {
+	m := mustRunStack(t, map[string]string{
+		"availability-zone-ids": `["use1-az6", "use1-az2"]`,
+	})
+
+	if got := stringInput(m.resource(t, "public-subnet-1", "aws:ec2/subnet:Subnet"), "availabilityZone"); got != "us-east-1d" {
+		t.Errorf("public-subnet-1 availabilityZone = %s, want us-east-1d", got)
+	}
+	if m.has("public-subnet-3") {
+		t.Error("created a third public subnet for two configured zone ids")
+	}
+
+	if _, err := runStack(t, map[string]string{"az-count": "5"}); err == nil {
+		t.Error("az-count larger than the region's zones did not fail")
+	}
+}
+
+func TestNatModes(t *testing.T) {
+	m := mustRunStack(t, nil)
+	if m.has("nat-gateway") || m.has("private-route-to-nat") {
+		t.Error("the default nat-mode none created a NAT gateway")
+	}
+
+	m = mustRunStack(t, map[string]string{"nat-mode": "single"})
+	if got := stringInput(m.resource(t, "nat-gateway", "aws:ec2/natGateway:NatGateway"), "subnetId"); got != "public-subnet-1-id" {
+		t.Errorf("nat-gateway subnetId = %s, want public-subnet-1-id", got)
+	}
+	route := m.resource(t, "private-route-to-nat", "aws:ec2/route:Route")
+	if stringInput(route, "routeTableId") != "private-route-table-id" || stringInput(route, "natGatewayId") != "nat-gateway-id" {
+		t.Errorf("private-route-to-nat = %v, want the shared private route table through nat-gateway", route)
+	}
+
+	m = mustRunStack(t, map[string]string{"nat-mode": "per-az"})
+	if m.has("nat-gateway") || m.has("private-route-table") {
+		t.Error("per-az mode also created the shared NAT gateway or route table")
+	}
+	for i := 1; i <= 3; i++ {
+		natGateway := fmt.Sprintf("nat-gateway-%d", i)
+		routeTable := fmt.Sprintf("private-route-table-%d", i)
+		if got := stringInput(m.resource(t, natGateway, "aws:ec2/natGateway:NatGateway"), "allocationId"); got != fmt.Sprintf("nat-eip-%d-id", i) {
+			t.Errorf("%s allocationId = %s, want nat-eip-%d-id", natGateway, got, i)
+		}
+		if got := stringInput(m.resource(t, natGateway, "aws:ec2/natGateway:NatGateway"), "subnetId"); got != fmt.Sprintf("public-subnet-%d-id", i) {
+			t.Errorf("%s subnetId = %s, want public-subnet-%d-id", natGateway, got, i)
+		}
+		route := m.resource(t, fmt.Sprintf("private-route-to-nat-%d", i), "aws:ec2/route:Route")
+		if stringInput(route, "routeTableId") != routeTable+"-id" || stringInput(route, "natGatewayId") != natGateway+"-id" ||
+			stringInput(route, "destinationCidrBlock") != "0.0.0.0/0" {
+			t.Errorf("private-route-to-nat-%d = %v, want 0.0.0.0/0 from %s through %s", i, route, routeTable, natGateway)
+		}
+		assoc := m.resource(t, fmt.Sprintf("private-route-table-assoc-%d", i), "aws:ec2/routeTableAssociation:RouteTableAssociation")
+		if stringInput(assoc, "subnetId") != fmt.Sprintf("private-subnet-%d-id", i) || stringInput(assoc, "routeTableId") != routeTable+"-id" {
+			t.Errorf("private-route-table-assoc-%d = %v, want private-subnet-%d in %s", i, assoc, i, routeTable)
+		}
+	}
+	if m.has("nat-gateway-4") {
+		t.Error("created a fourth NAT gateway with the default az-count of 3")
+	}
+}
+
+func TestIpv6(t *testing.T) {
+	m := mustRunStack(t, nil)
+	if m.has("egress-only-internet-gateway") || m.has("route-to-gateway-ipv6") {
+		t.Error("an IPv4-only stack created IPv6 routing")
+	}
+	if got := stringInput(m.resource(t, "load-balancer", "aws:lb/loadBalancer:LoadBalancer"), "ipAddressType"); got != "ipv4" {
+		t.Errorf("load-balancer ipAddressType = %s, want ipv4", got)
+	}
+
+	m = mustRunStack(t, map[string]string{"enable-ipv6": "true", "nat-mode": "per-az"})
+	if v := m.resource(t, "vpc", "aws:ec2/vpc:Vpc")["assignGeneratedIpv6CidrBlock"]; !v.IsBool() || !v.BoolValue() {
+		t.Error("vpc does not request an IPv6 block")
+	}
+	// each tier owns six /64s of the VPC's /56, one per zone slot
+	for name, cidr := range map[string]string{
+		"public-subnet-1":  "2600:1f18:abcd:ef00::/64",
+		"public-subnet-3":  "2600:1f18:abcd:ef02::/64",
+		"private-subnet-1": "2600:1f18:abcd:ef06::/64",
+		"private-subnet-2": "2600:1f18:abcd:ef07::/64",
+	} {
+		subnet := m.resource(t, name, "aws:ec2/subnet:Subnet")
+		if got := stringInput(subnet, "ipv6CidrBlock"); got != cidr {
+			t.Errorf("%s ipv6CidrBlock = %s, want %s", name, got, cidr)
+		}
+		if v := subnet["assignIpv6AddressOnCreation"]; !v.IsBool() || !v.BoolValue() {
+			t.Errorf("%s does not assign IPv6 addresses", name)
+		}
+	}
+
+	route := m.resource(t, "route-to-gateway-ipv6", "aws:ec2/route:Route")
+	if stringInput(route, "routeTableId") != "public-route-table-id" || stringInput(route, "gatewayId") != "internet-gateway-id" ||
+		stringInput(route, "destinationIpv6CidrBlock") != "::/0" {
+		t.Errorf("route-to-gateway-ipv6 = %v, want ::/0 from the public route table through the internet gateway", route)
+	}
+	m.resource(t, "egress-only-internet-gateway", "aws:ec2/egressOnlyInternetGateway:EgressOnlyInternetGateway")
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("private-route-to-egress-only-gateway-%d", i)
+		route := m.resource(t, name, "aws:ec2/route:Route")
+		if stringInput(route, "routeTableId") != fmt.Sprintf("private-route-table-%d-id", i) ||
+			stringInput(route, "egressOnlyGatewayId") != "egress-only-internet-gateway-id" ||
+			stringInput(route, "destinationIpv6CidrBlock") != "::/0" {
+			t.Errorf("%s = %v, want ::/0 from private-route-table-%d through the egress-only gateway", name, route, i)
+		}
+	}
+
+	if got := stringInput(m.resource(t, "load-balancer", "aws:lb/loadBalancer:LoadBalancer"), "ipAddressType"); got != "dualstack" {
+		t.Errorf("load-balancer ipAddressType = %s, want dualstack", got)
+	}
+}
+
+func TestVpcEndpoints(t *testing.T) {
+	m := mustRunStack(t, map[string]string{
+		"nat-mode":                "per-az",
+		"vpc-gateway-endpoints":   `["s3"]`,
+		"vpc-interface-endpoints": `["sns", "secretsmanager"]`,
+	})
+
+	gateway := m.resource(t, "vpc-endpoint-s3", "aws:ec2/vpcEndpoint:VpcEndpoint")
+	if stringInput(gateway, "serviceName") != "com.amazonaws.us-east-1.s3" || stringInput(gateway, "vpcEndpointType") != "Gateway" {
+		t.Errorf("vpc-endpoint-s3 = %v, want a gateway endpoint for com.amazonaws.us-east-1.s3", gateway)
+	}
+	var routeTables []string
+	for _, v := range arrayInput(gateway, "routeTableIds") {
+		routeTables = append(routeTables, v.StringValue())
+	}
+	want := "[public-route-table-id private-route-table-1-id private-route-table-2-id private-route-table-3-id]"
+	if fmt.Sprint(routeTables) != want {
+		t.Errorf("vpc-endpoint-s3 routeTableIds = %v, want %s", routeTables, want)
+	}
+
+	for _, service := range []string{"sns", "secretsmanager"} {
+		name := "vpc-endpoint-" + service
+		endpoint := m.resource(t, name, "aws:ec2/vpcEndpoint:VpcEndpoint")
+		if stringInput(endpoint, "serviceName") != "com.amazonaws.us-east-1."+service || stringInput(endpoint, "vpcEndpointType") != "Interface" {
+			t.Errorf("%s = %v, want an interface endpoint for com.amazonaws.us-east-1.%s", name, endpoint, service)
+		}
+		if v := endpoint["privateDnsEnabled"]; !v.IsBool() || !v.BoolValue() {
+			t.Errorf("%s does not enable private DNS", name)
+		}
+		if got := fmt.Sprint(arrayInput(endpoint, "subnetIds")); got != "[{private-subnet-1-id} {private-subnet-2-id} {private-subnet-3-id}]" {
+			t.Errorf("%s subnetIds = %s, want the private subnets", name, got)
+		}
+		if got := fmt.Sprint(arrayInput(endpoint, "securityGroupIds")); got != "[{vpc-endpoint-security-group-id}]" {
+			t.Errorf("%s securityGroupIds = %s, want vpc-endpoint-security-group", name, got)
+		}
+	}
+	ingress := arrayInput(m.resource(t, "vpc-endpoint-security-group", "aws:ec2/securityGroup:SecurityGroup"), "ingress")
+	if len(ingress) != 1 || ingress[0].ObjectValue()["fromPort"].NumberValue() != 443 ||
+		fmt.Sprint(arrayInput(ingress[0].ObjectValue(), "cidrBlocks")) != "[{10.0.0.0/16}]" {
+		t.Errorf("vpc-endpoint-security-group ingress = %v, want HTTPS from the VPC", ingress)
+	}
+
+	m = mustRunStack(t, nil)
+	if m.has("vpc-endpoint-s3") || m.has("vpc-endpoint-security-group") {
+		t.Error("a stack without endpoints configured created endpoint resources")
+	}
+}
+
+func TestFlowLogs(t *testing.T) {
+	m := mustRunStack(t, nil)
+	if m.has("vpc-flow-log") {
+		t.Error("flow logs are on by default")
+	}
+
+	m = mustRunStack(t, map[string]string{
+		"flow-logs-destination":    "cloud-watch-logs",
+		"flow-logs-traffic-type":   "REJECT",
+		"flow-logs-retention-days": "30",
+	})
+	logGroup := m.resource(t, "vpc-flow-log-group", "aws:cloudwatch/logGroup:LogGroup")
+	if stringInput(logGroup, "name") != "test-vpc-flow-log-group" || logGroup["retentionInDays"].NumberValue() != 30 {
+		t.Errorf("vpc-flow-log-group = %v, want test-vpc-flow-log-group kept for 30 days", logGroup)
+	}
+	flowLog := m.resource(t, "vpc-flow-log", "aws:ec2/flowLog:FlowLog")
+	for key, want := range map[string]string{
+		"vpcId":              "vpc-id",
+		"trafficType":        "REJECT",
+		"logDestinationType": "cloud-watch-logs",
+		"logDestination":     "arn:aws:mock:us-east-1:123456789012:vpc-flow-log-group",
+		"iamRoleArn":         "arn:aws:mock:us-east-1:123456789012:vpc-flow-log-role",
+	} {
+		if got := stringInput(flowLog, key); got != want {
+			t.Errorf("vpc-flow-log %s = %s, want %s", key, got, want)
+		}
+	}
+	if trust := stringInput(m.resource(t, "vpc-flow-log-role", "aws:iam/role:Role"), "assumeRolePolicy"); !strings.Contains(trust, `"Service":"vpc-flow-logs.amazonaws.com"`) {
+		t.Errorf("vpc-flow-log-role trust policy = %s, want the flow logs service", trust)
+	}
+	policy := m.resource(t, "vpc-flow-log-policy", "aws:iam/rolePolicy:RolePolicy")
+	if stringInput(policy, "role") != "vpc-flow-log-role-id" {
+		t.Errorf("vpc-flow-log-policy role = %s, want vpc-flow-log-role", stringInput(policy, "role"))
+	}
+	if document := stringInput(policy, "policy"); !strings.Contains(document, `"logs:PutLogEvents"`) ||
+		!strings.Contains(document, `"arn:aws:mock:us-east-1:123456789012:vpc-flow-log-group:*"`) {
+		t.Errorf("vpc-flow-log-policy = %s, want log delivery to the flow log group only", document)
+	}
+
+	m = mustRunStack(t, map[string]string{"flow-logs-destination": "s3"})
+	if m.has("vpc-flow-log-role") || m.has("vpc-flow-log-group") {
+		t.Error("s3 flow logs created CloudWatch delivery resources")
+	}
+	m.resource(t, "vpc-flow-log-bucket-public-access-block", "aws:s3/bucketPublicAccessBlock:BucketPublicAccessBlock")
+	flowLog = m.resource(t, "vpc-flow-log", "aws:ec2/flowLog:FlowLog")
+	if got := stringInput(flowLog, "logDestination"); got != "arn:aws:mock:us-east-1:123456789012:vpc-flow-log-bucket" {
+		t.Errorf("vpc-flow-log logDestination = %s, want the created bucket", got)
+	}
+
+	m = mustRunStack(t, map[string]string{"flow-logs-destination": "s3", "flow-logs-bucket-arn": "arn:aws:s3:::central-flow-logs"})
+	if m.has("vpc-flow-log-bucket") {
+		t.Error("flow-logs-bucket-arn still created a bucket")
+	}
+	if got := stringInput(m.resource(t, "vpc-flow-log", "aws:ec2/flowLog:FlowLog"), "logDestination"); got != "arn:aws:s3:::central-flow-logs" {
+		t.Errorf("vpc-flow-log logDestination = %s, want the configured bucket", got)
+	}
+}
+
+func TestSecurityGroupRules(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	ingressPorts := func(name string) []int {
+		var ports []int
+		for _, rule := range m.securityGroupRules(name, "ingress") {
+			ports = append(ports, int(rule["fromPort"].NumberValue()))
+		}
+		sort.Ints(ports)
+		return ports
+	}
+
+	if got := fmt.Sprint(ingressPorts("load-balancer-security-group")); got != "[80 443]" {
+		t.Errorf("load balancer ingress ports = %s, want [80 443]", got)
+	}
+	if got := fmt.Sprint(ingressPorts("application-security-group")); got != "[22 8080]" {
+		t.Errorf("application ingress ports = %s, want [22 8080]", got)
+	}
+	if got := fmt.Sprint(ingressPorts("database-security-group")); got != "[3306]" {
+		t.Errorf("database ingress ports = %s, want [3306]", got)
+	}
+
+	egress := m.resource(t, "alb-to-asg-healthcheck-egress", "aws:ec2/securityGroupRule:SecurityGroupRule")
+	if egress["fromPort"].NumberValue() != 8080 || stringInput(egress, "type") != "egress" {
+		t.Errorf("healthcheck rule = %v, want egress on 8080", egress)
+	}
+}
+
+// TestSecurityGroupUpgrade checks that stacks created before rule sets, whose
+// groups hold their ingress rules inline, update without touching them: the
+// derived rules keep the inline ingress and the old egress rule names.
+func TestSecurityGroupUpgrade(t *testing.T) {
+	m := mustRunStack(t, map[string]string{
+		"bastion":             "true",
+		"bastion-admin-cidrs": `["203.0.113.0/24"]`,
+	})
+
+	inline := func(name string) string {
+		var rules []string
+		for _, v := range arrayInput(m.resource(t, name, "aws:ec2/securityGroup:SecurityGroup"), "ingress") {
+			rule := v.ObjectValue()
+			peer := fmt.Sprint(arrayInput(rule, "cidrBlocks"), arrayInput(rule, "ipv6CidrBlocks"))
+			if groups := arrayInput(rule, "securityGroups"); len(groups) > 0 {
+				peer = fmt.Sprint(groups)
+			}
+			rules = append(rules, fmt.Sprintf("%s/%v %s", stringInput(rule, "protocol"), rule["fromPort"].NumberValue(), peer))
+		}
+		sort.Strings(rules)
+		return strings.Join(rules, ", ")
+	}
+	for name, want := range map[string]string{
+		"load-balancer-security-group": "tcp/443 [{0.0.0.0/0}] [{::/0}], tcp/80 [{0.0.0.0/0}] [{::/0}]",
+		"application-security-group":   "tcp/22 [{bastion-security-group-id}], tcp/22 [{load-balancer-security-group-id}], tcp/8080 [{bastion-security-group-id}], tcp/8080 [{load-balancer-security-group-id}]",
+		"database-security-group":      "tcp/3306 [{application-security-group-id}], tcp/3306 [{bastion-security-group-id}]",
+		"bastion-security-group":       "tcp/22 [{203.0.113.0/24}] []",
+	} {
+		if got := inline(name); got != want {
+			t.Errorf("%s inline ingress = %s, want %s", name, got, want)
+		}
+	}
+	if names := m.standaloneIngress(); len(names) != 0 {
+		t.Errorf("standalone ingress rules %v would duplicate the inline ones of older stacks", names)
+	}
+	for _, name := range []string{
+		"application-security-group-egress-rule",
+		"alb-to-asg-healthcheck-egress",
+		"application-security-group-port-egress-rule",
+		"bastion-to-application-egress",
+		"bastion-to-database-egress",
+	} {
+		m.resource(t, name, "aws:ec2/securityGroupRule:SecurityGroupRule")
+	}
+}
+
+func TestSecurityGroupRuleSet(t *testing.T) {
+	m := mustRunStack(t, map[string]string{"security-group-rules": `[
+		{"group": "load-balancer", "direction": "ingress", "protocol": "tcp", "from-port": 443, "cidr-blocks": ["198.51.100.0/24"], "description": "office"},
+		{"group": "application", "direction": "ingress", "protocol": "tcp", "from-port": 8080, "source-group": "load-balancer"},
+		{"group": "application", "direction": "egress", "protocol": "tcp", "from-port": 443, "prefix-list-ids": ["pl-0123456789abcdef0"]},
+		{"name": "app-to-db", "group": "application", "direction": "egress", "protocol": "tcp", "from-port": 3306, "to-port": 3306, "source-group": "database"}
+	]`})
+
+	ingress := m.securityGroupRules("load-balancer-security-group", "ingress")
+	if len(ingress) != 1 || ingress[0]["toPort"].NumberValue() != 443 ||
+		fmt.Sprint(ingress[0]["cidrBlocks"].ArrayValue()) != "[{198.51.100.0/24}]" || stringInput(ingress[0], "description") != "office" {
+		t.Errorf("load balancer ingress = %v, want 443 from the office only", ingress)
+	}
+	app := m.resource(t, "application-ingress-tcp-8080-load-balancer", "aws:ec2/securityGroupRule:SecurityGroupRule")
+	if stringInput(app, "sourceSecurityGroupId") != "load-balancer-security-group-id" || stringInput(app, "securityGroupId") != "application-security-group-id" {
+		t.Errorf("application ingress = %v, want 8080 from the load balancer", app)
+	}
+	egress := m.securityGroupRules("application-security-group", "egress")
+	if len(egress) != 2 || !m.has("app-to-db") {
+		t.Errorf("application egress = %v, want the prefix list rule and app-to-db", egress)
+	}
+	if m.has("alb-to-asg-healthcheck-egress") || len(m.securityGroupRules("database-security-group", "ingress")) != 0 {
+		t.Error("default rules were created alongside security-group-rules")
+	}
+	for _, name := range []string{"load-balancer-security-group", "application-security-group", "database-security-group"} {
+		if _, ok := m.resource(t, name, "aws:ec2/securityGroup:SecurityGroup")["ingress"]; ok {
+			t.Errorf("%s has inline ingress alongside security-group-rules", name)
+		}
+	}
+
+	for _, tt := range []struct {
+		config map[string]string
+		want   string
+	}{
+		{map[string]string{"ports": "[8080]", "security-group-rules": `[{"group": "application", "direction": "ingress", "protocol": "tcp", "from-port": 8080, "source-group": "load-balancer"}]`}, "ports: is replaced by security-group-rules"},
+		{map[string]string{"security-group-rules": `[{"group": "bastion", "direction": "ingress", "protocol": "tcp", "from-port": 22, "cidr-blocks": ["203.0.113.0/24"]}]`}, `group "bastion"`},
+		{map[string]string{"security-group-rules": `[{"group": "database", "direction": "ingress", "protocol": "tcp", "from-port": 3306, "source-group": "application", "cidr-blocks": ["10.0.0.0/16"]}]`}, "needs exactly one"},
+		{map[string]string{"security-group-rules": `[{"group": "database", "direction": "ingress", "protocol": "tcp", "from-port": 3306, "cidr-blocks": ["2001:db8::/48"]}]`}, "belongs in the other"},
+		{map[string]string{"security-group-rules": `[{"group": "database", "direction": "inbound", "protocol": "tcp", "from-port": 3306, "source-group": "application"}]`}, `direction "inbound"`},
+		{map[string]string{"security-group-rules": `[{"group": "database", "direction": "ingress", "protocol": "tcp", "from-port": 3306, "to-port": 80, "source-group": "application"}]`}, "not a range"},
+		{map[string]string{"security-group-rules": `[{"group": "application", "direction": "egress", "protocol": "all", "from-port": 443, "cidr-blocks": ["0.0.0.0/0"]}]`}, "takes no ports"},
+		{map[string]string{"security-group-rules": `[{"group": "application", "direction": "egress", "protocol": "tcp", "from-port": 443, "prefix-list-ids": ["s3"]}]`}, "not a prefix list id"},
+		{map[string]string{"access-mode": "ssm", "ssh-key": "", "security-group-rules": `[{"group": "application", "direction": "ingress", "protocol": "tcp", "from-port": 1, "to-port": 1024, "source-group": "load-balancer"}]`}, "port 22"},
+		{map[string]string{"security-group-rules": `[
+			{"group": "application", "direction": "egress", "protocol": "tcp", "from-port": 443, "cidr-blocks": ["0.0.0.0/0"]},
+			{"group": "application", "direction": "egress", "protocol": "tcp", "from-port": 443, "cidr-blocks": ["0.0.0.0/0"], "description": "again"}
+		]`}, "defined twice"},
+	} {
+		if _, err := runStack(t, tt.config); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: error = %v, want it to mention %s", tt.config, err, tt.want)
+		}
+	}
+}
+
+func TestSessionManagerAccess(t *testing.T) {
+	m := mustRunStack(t, map[string]string{
+		"access-mode":                 "ssm",
+		"ssh-key":                     "",
+		"session-manager-preferences": "true",
+		"session-logs-destination":    "cloud-watch-logs",
+	})
+
+	if _, ok := m.resource(t, "webapp-launch-template", "aws:ec2/launchTemplate:LaunchTemplate")["keyName"]; ok {
+		t.Error("launch template has a key pair with access-mode ssm")
+	}
+	for _, rule := range m.securityGroupRules("application-security-group", "ingress") {
+		if port := rule["fromPort"].NumberValue(); port != 8080 {
+			t.Errorf("application security group opens port %v with access-mode ssm", port)
+		}
+	}
+	core := m.resource(t, "ssm-managed-instance-core-policy", "aws:iam/rolePolicyAttachment:RolePolicyAttachment")
+	if !strings.HasSuffix(stringInput(core, "policyArn"), "/AmazonSSMManagedInstanceCore") {
+		t.Errorf("instance role policy = %v, want AmazonSSMManagedInstanceCore", core)
+	}
+	preferences := stringInput(m.resource(t, "session-manager-preferences", "aws:ssm/document:Document"), "content")
+	if !strings.Contains(preferences, `"cloudWatchLogGroupName":"test-session-manager-logs"`) {
+		t.Errorf("session preferences = %s, want sessions logged to test-session-manager-logs", preferences)
+	}
+
+	m = mustRunStack(t, map[string]string{"access-mode": "ssm", "ssh-key": ""})
+	if m.has("session-manager-preferences") {
+		t.Error("stack took over the account-wide Session Manager preferences without session-manager-preferences")
+	}
+
+	m = mustRunStack(t, nil)
+	if m.has("ssm-managed-instance-core-policy") || m.has("session-manager-preferences") {
+		t.Error("access-mode ssh set up Session Manager")
+	}
+
+	for _, tt := range []struct {
+		config map[string]string
+		want   string
+	}{
+		{map[string]string{"access-mode": "ssm"}, "ssh-key: must not be set"},
+		{map[string]string{"access-mode": "ssm", "ssh-key": "", "ports": "[22, 8080]"}, "port 22"},
+		{map[string]string{"access-mode": "ssm", "ssh-key": "", "app-subnet-tier": "private", "vpc-interface-endpoints": `["secretsmanager", "ssm"]`}, "ssmmessages"},
+		{map[string]string{"session-logs-destination": "s3"}, "requires access-mode ssm"},
+		{map[string]string{"session-manager-preferences": "true"}, "requires access-mode ssm"},
+		{map[string]string{"access-mode": "ssm", "ssh-key": "", "session-logs-destination": "s3"}, "requires session-manager-preferences"},
+		{map[string]string{"ssh-key": ""}, "ssh-key: is required"},
+	} {
+		if _, err := runStack(t, tt.config); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: error = %v, want it to mention %s", tt.config, err, tt.want)
+		}
+	}
+}
+
+func TestBastion(t *testing.T) {
+	m := mustRunStack(t, map[string]string{
+		"bastion":             "true",
+		"bastion-admin-cidrs": `["203.0.113.0/24", "2001:db8::/48"]`,
+	})
+
+	host := m.resource(t, "bastion-host", "aws:ec2/instance:Instance")
+	if stringInput(host, "subnetId") != "public-subnet-1-id" || stringInput(host, "ami") != "ami-0123456789abcdef0" || stringInput(host, "keyName") != "demo-key" {
+		t.Errorf("bastion = %v, want the latest AMI in public-subnet-1 with demo-key", host)
+	}
+	ingress := m.securityGroupRules("bastion-security-group", "ingress")
+	if len(ingress) != 1 || ingress[0]["fromPort"].NumberValue() != 22 ||
+		fmt.Sprint(ingress[0]["cidrBlocks"].ArrayValue()) != "[{203.0.113.0/24}]" ||
+		fmt.Sprint(ingress[0]["ipv6CidrBlocks"].ArrayValue()) != "[{2001:db8::/48}]" {
+		t.Errorf("bastion ingress = %v, want SSH from the admin CIDRs only", ingress)
+	}
+	for _, tt := range []struct {
+		group string
+		port  float64
+	}{
+		{"application-security-group", 22},
+		{"application-security-group", 8080},
+		{"database-security-group", 3306},
+	} {
+		found := false
+		for _, rule := range m.securityGroupRules(tt.group, "ingress") {
+			if stringInput(rule, "sourceSecurityGroupId") == "bastion-security-group-id" && rule["fromPort"].NumberValue() == tt.port {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s does not admit the bastion on %v", tt.group, tt.port)
+		}
+	}
+	for name, want := range map[string]struct {
+		group string
+		port  float64
+	}{
+		"bastion-to-application-ssh-egress": {"application-security-group-id", 22},
+		"bastion-to-database-egress":        {"database-security-group-id", 3306},
+	} {
+		egress := m.resource(t, name, "aws:ec2/securityGroupRule:SecurityGroupRule")
+		if stringInput(egress, "sourceSecurityGroupId") != want.group || egress["fromPort"].NumberValue() != want.port {
+			t.Errorf("%s = %v, want %v to %s", name, egress, want.port, want.group)
+		}
+	}
+
+	m = mustRunStack(t, nil)
+	if m.has("bastion-host") || m.has("bastion-security-group") {
+		t.Error("created a bastion without bastion")
+	}
+
+	for _, tt := range []struct {
+		config map[string]string
+		want   string
+	}{
+		{map[string]string{"bastion": "true"}, "bastion-admin-cidrs: must list"},
+		{map[string]string{"bastion": "true", "bastion-admin-cidrs": `["0.0.0.0/0"]`}, "whole internet"},
+		{map[string]string{"bastion": "true", "bastion-admin-cidrs": `["203.0.113.0/24"]`, "access-mode": "ssm", "ssh-key": ""}, "requires access-mode ssh"},
+		{map[string]string{"bastion-admin-cidrs": `["203.0.113.0/24"]`}, "requires bastion"},
+	} {
+		if _, err := runStack(t, tt.config); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: error = %v, want it to mention %s", tt.config, err, tt.want)
+		}
+	}
+}
+
+func TestPostgresEngineProfile(t *testing.T) {
+	m := mustRunStack(t, map[string]string{"db-engine-name": "postgres"})
+
+	db := m.resource(t, "db", "aws:rds/instance:Instance")
+	if stringInput(db, "engineVersion") != "16.1" || db["port"].NumberValue() != 5432 {
+		t.Errorf("db engineVersion = %s, port = %v, want 16.1 on 5432", stringInput(db, "engineVersion"), db["port"])
+	}
+	if family := stringInput(m.resource(t, "param-group", "aws:rds/parameterGroup:ParameterGroup"), "family"); family != "postgres16" {
+		t.Errorf("parameter group family = %s, want postgres16", family)
+	}
+	ingress := m.securityGroupRules("database-security-group", "ingress")
+	if port := ingress[0]["fromPort"].NumberValue(); port != 5432 {
+		t.Errorf("database ingress port = %v, want 5432", port)
+	}
+	egress := m.resource(t, "application-security-group-egress-rule", "aws:ec2/securityGroupRule:SecurityGroupRule")
+	if port := egress["toPort"].NumberValue(); port != 5432 {
+		t.Errorf("application egress port = %v, want 5432", port)
+	}
+	if userData := launchTemplateUserData(t, m); !strings.Contains(userData, propertyLine("spring.datasource.url", "jdbc:postgresql://db.example.internal:5432/csye6225")) {
+		t.Errorf("user data does not point at the postgres endpoint:\n%s", userData)
+	}
+}
+
+func TestDbProfiles(t *testing.T) {
+	m := mustRunStack(t, nil)
+	db := m.resource(t, "db", "aws:rds/instance:Instance")
+	if db["multiAz"].BoolValue() || !db["skipFinalSnapshot"].BoolValue() || db["storageEncrypted"].BoolValue() {
+		t.Errorf("dev db = %v, want single-AZ, unencrypted and no final snapshot", db)
+	}
+	if m.has("db-kms-key") || m.has("rds-monitoring-role") {
+		t.Error("dev profile created a KMS key or monitoring role")
+	}
+
+	m = mustRunStack(t, map[string]string{"db-profile": "prod", "db-backup-window": "03:00-04:00"})
+	db = m.resource(t, "db", "aws:rds/instance:Instance")
+	for _, key := range []string{"multiAz", "storageEncrypted", "deletionProtection", "performanceInsightsEnabled"} {
+		if !db[resource.PropertyKey(key)].BoolValue() {
+			t.Errorf("prod db %s is not true", key)
+		}
+	}
+	if class := stringInput(db, "instanceClass"); class != "db.t3.medium" {
+		t.Errorf("prod db instanceClass = %s, want db.t3.medium, which runs Performance Insights", class)
+	}
+	if db["skipFinalSnapshot"].BoolValue() || stringInput(db, "finalSnapshotIdentifier") != "csye6225-test-final-snapshot" {
+		t.Errorf("prod db final snapshot = %v / %s", db["skipFinalSnapshot"], stringInput(db, "finalSnapshotIdentifier"))
+	}
+	if db["backupRetentionPeriod"].NumberValue() != 7 || db["monitoringInterval"].NumberValue() != 60 || stringInput(db, "backupWindow") != "03:00-04:00" {
+		t.Errorf("prod db backups and monitoring = %v, %v, %s", db["backupRetentionPeriod"], db["monitoringInterval"], stringInput(db, "backupWindow"))
+	}
+	if key := m.resource(t, "db-kms-key", "aws:kms/key:Key"); !key["enableKeyRotation"].BoolValue() {
+		t.Error("db KMS key does not rotate")
+	}
+	m.resource(t, "rds-monitoring-role", "aws:iam/role:Role")
+
+	_, err := runStack(t, map[string]string{
+		"db-profile":               "prod",
+		"db-multi-az":              "false",
+		"db-deletion-protection":   "false",
+		"db-backup-retention-days": "1",
+	})
+	if err == nil {
+		t.Fatal("weakened prod profile did not fail")
+	}
+	for _, key := range []string{"db-multi-az", "db-deletion-protection", "db-backup-retention-days"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+
+	if _, err := runStack(t, map[string]string{"db-profile": "prod", "db-instance-class": "db.t3.micro"}); err == nil || !strings.Contains(err.Error(), "db-performance-insights") {
+		t.Errorf("prod on db.t3.micro: error = %v, want Performance Insights rejected", err)
+	}
+	mustRunStack(t, map[string]string{"db-profile": "prod", "db-instance-class": "db.t3.micro", "db-performance-insights": "false"})
+}
+
+func TestDbParametersConfig(t *testing.T) {
+	t.Setenv(pulumi.EnvDryRun, "true")
+	m := mustRunStack(t, map[string]string{
+		"db-engine-name": "postgres",
+		"db-parameters":  `{"max_connections": {"value": "200"}, "work_mem": {"value": "8192"}}`,
+	})
+
+	params := map[string]resource.PropertyMap{}
+	for _, p := range m.resource(t, "param-group", "aws:rds/parameterGroup:ParameterGroup")["parameters"].ArrayValue() {
+		params[stringInput(p.ObjectValue(), "name")] = p.ObjectValue()
+	}
+	for name, method := range map[string]string{
+		"max_connections":            "pending-reboot",
+		"work_mem":                   "immediate",
+		"log_min_duration_statement": "immediate",
+	} {
+		if got := stringInput(params[name], "applyMethod"); got != method {
+			t.Errorf("%s applyMethod = %q, want %s", name, got, method)
+		}
+	}
+	if applied := m.resources["param-group-applied"]; applied.ID != "param-group-id" {
+		t.Errorf("param-group-applied reads %q, want the live param-group", applied.ID)
+	}
+
+	// removing every engine parameter leaves the group as it was before
+	// engine profiles existed
+	m = mustRunStack(t, map[string]string{
+		"db-parameters": `{"character_set_server": {"remove": true}, "collation_server": {"remove": true}, "slow_query_log": {"remove": true}, "long_query_time": {"remove": true}}`,
+	})
+	if params, ok := m.resource(t, "param-group", "aws:rds/parameterGroup:ParameterGroup")["parameters"]; ok {
+		t.Errorf("param-group parameters = %v, want none", params)
+	}
+
+	for config, want := range map[string]string{
+		`{"innodb_log_file_size": {"value": "134217728", "apply-method": "immediate"}}`: "innodb_log_file_size is static",
+		`{"max_connections": {"remove": true}}`:                                         "cannot be removed",
+		`{"slow_query_log": {"remove": true, "value": "0"}}`:                            "takes no value",
+	} {
+		if _, err := runStack(t, map[string]string{"db-parameters": config}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("db-parameters %s: error = %v, want it to mention %s", config, err, want)
+		}
+	}
+}
+
+func TestDbAlarmsAndLogExports(t *testing.T) {
+	m := mustRunStack(t, nil)
+	if m.has("db-alerts") || m.has("db-cpu-alarm") {
+		t.Error("dev profile created database alarms")
+	}
+
+	m = mustRunStack(t, map[string]string{
+		"db-alarms":           "true",
+		"db-read-replicas":    "1",
+		"db-log-exports":      `["error", "slowquery"]`,
+		"db-alarm-thresholds": `{"cpu-percent": 90}`,
+		"alert-email":         "ops@example.com",
+	})
+	db := m.resource(t, "db", "aws:rds/instance:Instance")
+	if exports := db["enabledCloudwatchLogsExports"].ArrayValue(); len(exports) != 2 || exports[1].StringValue() != "slowquery" {
+		t.Errorf("log exports = %v, want error and slowquery", exports)
+	}
+	m.resource(t, "db-alerts-email", "aws:sns/topicSubscription:TopicSubscription")
+
+	for name, want := range map[string]float64{
+		"db-cpu-alarm":                   90,
+		"db-free-storage-alarm":          20 * 1024 * 1024 * 1024 / 10,
+		"db-freeable-memory-alarm":       64 * 1024 * 1024,
+		"db-connections-alarm":           100,
+		"db-replica-1-replica-lag-alarm": 60,
+	} {
+		alarm := m.resource(t, name, "aws:cloudwatch/metricAlarm:MetricAlarm")
+		if got := alarm["threshold"].NumberValue(); got != want {
+			t.Errorf("%s threshold = %v, want %v", name, got, want)
+		}
+		if actions := alarm["alarmActions"].ArrayValue(); len(actions) != 1 || !strings.HasSuffix(actions[0].StringValue(), ":db-alerts") {
+			t.Errorf("%s alarm actions = %v, want the db-alerts topic", name, actions)
+		}
+	}
+	lag := m.resource(t, "db-replica-1-replica-lag-alarm", "aws:cloudwatch/metricAlarm:MetricAlarm")
+	if id := stringInput(lag["dimensions"].ObjectValue(), "DBInstanceIdentifier"); id != "db-replica-1" {
+		t.Errorf("replica lag alarm watches %s, want db-replica-1", id)
+	}
+	if m.has("db-replica-lag-alarm") {
+		t.Error("the primary got a replica lag alarm")
+	}
+
+	_, err := runStack(t, map[string]string{"db-engine-name": "postgres", "db-log-exports": `["slowquery"]`})
+	if err == nil || !strings.Contains(err.Error(), "db-log-exports") {
+		t.Errorf("postgres slowquery export: error = %v", err)
+	}
+}
+
+func TestReadReplicas(t *testing.T) {
+	m := mustRunStack(t, map[string]string{"db-read-replicas": "2"})
+
+	for i, zone := range []string{"us-east-1b", "us-east-1c"} {
+		name := fmt.Sprintf("db-replica-%d", i+1)
+		replica := m.resource(t, name, "aws:rds/instance:Instance")
+		if stringInput(replica, "replicateSourceDb") != "db" || stringInput(replica, "availabilityZone") != zone {
+			t.Errorf("%s = %v, want a replica of db in %s", name, replica, zone)
+		}
+	}
+	userData := launchTemplateUserData(t, m)
+	if !strings.Contains(userData, propertyLine("application.datasource.reader-url", "jdbc:mariadb:loadbalance://db-replica-1.example.internal:3306,db-replica-2.example.internal:3306/csye6225")) {
+		t.Errorf("user data does not balance reads over the replicas:\n%s", userData)
+	}
+
+	m = mustRunStack(t, nil)
+	if userData := launchTemplateUserData(t, m); !strings.Contains(userData, propertyLine("application.datasource.reader-url", "jdbc:mariadb://db.example.internal:3306/csye6225")) {
+		t.Errorf("user data without replicas does not read from the writer:\n%s", userData)
+	}
+}
+
+func TestAuroraCluster(t *testing.T) {
+	m := mustRunStack(t, map[string]string{
+		"db-mode":           "aurora",
+		"db-engine-name":    "postgres",
+		"db-instance-class": "db.t4g.medium",
+		"db-read-replicas":  "1",
+	})
+
+	cluster := m.resource(t, "db-cluster", "aws:rds/cluster:Cluster")
+	if stringInput(cluster, "engine") != "aurora-postgresql" || cluster["port"].NumberValue() != 5432 {
+		t.Errorf("cluster = %v, want aurora-postgresql on 5432", cluster)
+	}
+	family := stringInput(m.resource(t, "cluster-param-group", "aws:rds/clusterParameterGroup:ClusterParameterGroup"), "family")
+	if family != "aurora-postgresql16" {
+		t.Errorf("cluster parameter group family = %s, want aurora-postgresql16", family)
+	}
+	if zone := stringInput(m.resource(t, "db-reader-1", "aws:rds/clusterInstance:ClusterInstance"), "availabilityZone"); zone != "us-east-1b" {
+		t.Errorf("reader zone = %s, want us-east-1b", zone)
+	}
+	m.resource(t, "db-writer", "aws:rds/clusterInstance:ClusterInstance")
+	if m.has("db") {
+		t.Error("aurora mode also created an RDS instance")
+	}
+
+	userData := launchTemplateUserData(t, m)
+	for _, want := range []string{
+		propertyLine("spring.datasource.url", "jdbc:postgresql://db-cluster.cluster-mock.example.internal:5432/csye6225"),
+		propertyLine("application.datasource.reader-url", "jdbc:postgresql://db-cluster.cluster-ro-mock.example.internal:5432/csye6225"),
+	} {
+		if !strings.Contains(userData, want) {
+			t.Errorf("user data does not contain %s:\n%s", want, userData)
+		}
+	}
+
+	if _, err := runStack(t, map[string]string{"db-mode": "aurora", "db-instance-class": "db.t4g.medium"}); err == nil || !strings.Contains(err.Error(), "db-engine-name") {
+		t.Errorf("aurora with mariadb: error = %v, want db-engine-name rejected", err)
+	}
+}
+
+func TestDbRestore(t *testing.T) {
+	m := mustRunStack(t, map[string]string{"db-restore-snapshot": "arn:aws:rds:us-east-1:123456789012:snapshot:prod-nightly"})
+	db := m.resource(t, "db", "aws:rds/instance:Instance")
+	if stringInput(db, "snapshotIdentifier") != "arn:aws:rds:us-east-1:123456789012:snapshot:prod-nightly" {
+		t.Errorf("db = %v, want it restored from the snapshot", db)
+	}
+	if _, ok := db["dbName"]; ok {
+		t.Error("restored db sets dbName, which comes from the snapshot")
+	}
+
+	m = mustRunStack(t, map[string]string{"db-restore-source": "csye6225-prod", "db-restore-time": "2026-10-01T06:00:00Z"})
+	restore := m.resource(t, "db", "aws:rds/instance:Instance")["restoreToPointInTime"].ObjectValue()
+	if stringInput(restore, "sourceDbInstanceIdentifier") != "csye6225-prod" || stringInput(restore, "restoreTime") != "2026-10-01T06:00:00Z" {
+		t.Errorf("restoreToPointInTime = %v, want csye6225-prod at 2026-10-01T06:00:00Z", restore)
+	}
+
+	m = mustRunStack(t, map[string]string{
+		"db-mode":           "aurora",
+		"db-engine-name":    "mysql",
+		"db-instance-class": "db.t4g.medium",
+		"db-restore-source": "csye6225-prod",
+	})
+	restore = m.resource(t, "db-cluster", "aws:rds/cluster:Cluster")["restoreToPointInTime"].ObjectValue()
+	if stringInput(restore, "sourceClusterIdentifier") != "csye6225-prod" || !restore["useLatestRestorableTime"].BoolValue() {
+		t.Errorf("restoreToPointInTime = %v, want the latest time of csye6225-prod", restore)
+	}
+
+	for _, tt := range []struct {
+		config map[string]string
+		want   string
+	}{
+		{map[string]string{"db-restore-snapshot": "prod-nightly", "db-restore-source": "csye6225-prod"}, "db-restore-source"},
+		{map[string]string{"db-restore-snapshot": "arn:aws:rds:us-east-1:123456789012:cluster-snapshot:prod"}, "db-restore-snapshot"},
+		{map[string]string{"db-restore-time": "2026-10-01T06:00:00Z"}, "requires db-restore-source"},
+		{map[string]string{"db-restore-source": "csye6225-prod", "db-restore-time": "yesterday"}, "RFC 3339"},
+	} {
+		if _, err := runStack(t, tt.config); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: error = %v, want it to mention %s", tt.config, err, tt.want)
+		}
+	}
+}
+
+// launchTemplateUserData decodes the user data of the web launch template.
+func launchTemplateUserData(t *testing.T, m *mocks) string {
+	t.Helper()
+	template := m.resource(t, "webapp-launch-template", "aws:ec2/launchTemplate:LaunchTemplate")
+	userData, err := b64.StdEncoding.DecodeString(stringInput(template, "userData"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(userData)
+}
+
+func TestAutoScalingGroup(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	asg := m.resource(t, "auto-scaling-group", "aws:autoscaling/group:Group")
+	for key, want := range map[string]float64{"minSize": 1, "maxSize": 3, "desiredCapacity": 1} {
+		if got := asg[resource.PropertyKey(key)].NumberValue(); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	zones := asg["vpcZoneIdentifiers"].ArrayValue()
+	if len(zones) != 3 || zones[0].StringValue() != "public-subnet-1-id" {
+		t.Errorf("vpcZoneIdentifiers = %v, want the three public subnets", zones)
+	}
+
+	m = mustRunStack(t, map[string]string{"app-subnet-tier": "private", "nat-mode": "single"})
+	asg = m.resource(t, "auto-scaling-group", "aws:autoscaling/group:Group")
+	if zones := asg["vpcZoneIdentifiers"].ArrayValue(); zones[0].StringValue() != "private-subnet-1-id" {
+		t.Errorf("vpcZoneIdentifiers = %v, want the private subnets", zones)
+	}
+	lb := m.resource(t, "load-balancer", "aws:lb/loadBalancer:LoadBalancer")
+	if subnets := lb["subnets"].ArrayValue(); subnets[0].StringValue() != "public-subnet-1-id" {
+		t.Errorf("load balancer subnets = %v, want the public subnets", subnets)
+	}
+
+	mustRunStack(t, map[string]string{"app-subnet-tier": "private", "vpc-interface-endpoints": `["secretsmanager", "sns"]`})
+	for _, tt := range []struct {
+		config map[string]string
+		want   string
+	}{
+		{map[string]string{"app-subnet-tier": "private"}, "private instances need egress"},
+		{map[string]string{"app-subnet-tier": "private", "vpc-interface-endpoints": `["sns"]`}, "need secretsmanager"},
+	} {
+		if _, err := runStack(t, tt.config); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: error = %v, want it to mention %s", tt.config, err, tt.want)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	for name, typ := range map[string]string{
+		"vpc":              "aws:ec2/vpc:Vpc",
+		"public-subnet-1":  "aws:ec2/subnet:Subnet",
+		"internet-gateway": "aws:ec2/internetGateway:InternetGateway",
+		"db":               "aws:rds/instance:Instance",
+		"load-balancer":    "aws:lb/loadBalancer:LoadBalancer",
+	} {
+		tags := m.resource(t, name, typ)["tags"].ObjectValue()
+		if stringInput(tags, "course") != "CSYE-6225" || stringInput(tags, "assign") != "Assign-6" {
+			t.Errorf("%s tags = %v, want course and assign tags", name, tags)
+		}
+	}
+}
+
+func TestLambdaEnvironment(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	fn := m.resource(t, "lambda-function", "aws:lambda/function:Function")
+	vars := fn["environment"].ObjectValue()["variables"].ObjectValue()
+	for key, want := range map[string]string{
+		"SMTP_HOST":      "smtp.example.com",
+		"SMTP_PORT":      "587",
+		"SMTP_USERNAME":  "postmaster@example.com",
+		"SENDER_EMAIL":   "noreply@example.com",
+		"DYNAMODB_TABLE": "csye6225-submissions-table",
+	} {
+		if got := stringInput(vars, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if got := stringInput(vars, "BUCKET_NAME"); !strings.HasPrefix(got, "csyebucket") {
+		t.Errorf("BUCKET_NAME = %q, want a csyebucket name", got)
+	}
+}
+
+func TestLeastPrivilegePolicies(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	for name, want := range map[string][]string{
+		"sns-publish-policy":    {`"sns:Publish"`, `"arn:aws:mock:us-east-1:123456789012:csye6225-submissions"`},
+		"dynamodb-policy":       {`"arn:aws:mock:us-east-1:123456789012:dynamodb"`},
+		"lambda-logging-policy": {`"arn:aws-us-gov:logs:us-east-1:123456789012:log-group:/aws/lambda/csye-submissions-lambda:*"`},
+	} {
+		typ := "aws:iam/policy:Policy"
+		if name == "sns-publish-policy" {
+			typ = "aws:iam/rolePolicy:RolePolicy"
+		}
+		policy := stringInput(m.resource(t, name, typ), "policy")
+		for _, w := range want {
+			if !strings.Contains(policy, w) {
+				t.Errorf("%s = %s, want it to contain %s", name, policy, w)
+			}
+		}
+		if strings.Contains(policy, "*:*") || strings.Contains(policy, "table/*") || strings.Contains(policy, "FullAccess") {
+			t.Errorf("%s = %s, want no wildcard resources", name, policy)
+		}
+	}
+	// Lambda creates its own group; managing it would collide with one it
+	// already created
+	for name, args := range m.resources {
+		if args.TypeToken == "aws:cloudwatch/logGroup:LogGroup" && strings.HasPrefix(stringInput(args.Inputs, "name"), "/aws/lambda/") {
+			t.Errorf("%s manages the function's log group", name)
+		}
+	}
+}
+
+func TestSnsTopicInUserData(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	userData := launchTemplateUserData(t, m)
+	for _, want := range []string{
+		propertyLine("application.sns.topic-arn", "arn:aws:mock:us-east-1:123456789012:csye6225-submissions"),
+		"REGION='us-east-1'",
+	} {
+		if !strings.Contains(userData, want) {
+			t.Errorf("user data does not contain %s:\n%s", want, userData)
+		}
+	}
+
+	if _, err := runStack(t, map[string]string{"app-properties": `{"application.sns.topic-arn": "arn:aws:sns:us-east-1:123456789012:other"}`}); err == nil || !strings.Contains(err.Error(), "application.sns.topic-arn") {
+		t.Errorf("overriding the topic ARN: error = %v, want it rejected", err)
+	}
+}
+
+func TestDbPasswordModes(t *testing.T) {
+	m := mustRunStack(t, nil)
+
+	db := m.resource(t, "db", "aws:rds/instance:Instance")
+	if db.HasValue("manageMasterUserPassword") || !db["password"].IsSecret() {
+		t.Errorf("db = %v, want a generated secret password that RDS does not rotate", db)
+	}
+	generated := m.resource(t, "db-master-password-generated", "random:index/randomPassword:RandomPassword")
+	if generated["length"].NumberValue() != 32 || generated["special"].BoolValue() {
+		t.Errorf("generated password = %v, want 32 letters and digits", generated)
+	}
+	credentials := m.resource(t, "db-master-password-secret-version", "aws:secretsmanager/secretVersion:SecretVersion")["secretString"]
+	if password := db["password"].SecretValue().Element.StringValue(); len(password) != 32 ||
+		!strings.Contains(credentials.SecretValue().Element.StringValue(), `"password":"`+password+`"`) {
+		t.Errorf("db password = %q, want the 32 characters stored in %v", password, credentials)
+	}
+	if userData := launchTemplateUserData(t, m); strings.Contains(userData, "refresh-db-password") {
+		t.Error("user data refreshes a password that does not rotate")
+	}
+
+	// a stack that already sets db-master-password keeps using it
+	m = mustRunStack(t, map[string]string{"db-master-password": "test-password"})
+	if m.has("db-master-password-generated") {
+		t.Error("generated a password for a stack that sets db-master-password")
+	}
+	if password := m.resource(t, "db", "aws:rds/instance:Instance")["password"]; password.SecretValue().Element.StringValue() != "test-password" {
+		t.Errorf("db password = %v, want db-master-password", password)
+	}
+
+	m = mustRunStack(t, map[string]string{"db-password-mode": "managed", "app-service": "webapp"})
+	db = m.resource(t, "db", "aws:rds/instance:Instance")
+	if !db["manageMasterUserPassword"].BoolValue() || db.HasValue("password") {
+		t.Errorf("db = %v, want a managed master password and no password input", db)
+	}
+	if m.has("db-master-password-secret") {
+		t.Error("created a secret for the managed password")
+	}
+	policy := stringInput(m.resource(t, "db-password-secret-read-policy", "aws:iam/rolePolicy:RolePolicy"), "policy")
+	if !strings.Contains(policy, "secret:rds!db-mock") {
+		t.Errorf("secret read policy = %s, want it scoped to the RDS managed secret", policy)
+	}
+	// the rotated password reaches running instances
+	userData := launchTemplateUserData(t, m)
+	if !strings.Contains(userData, "systemctl enable --now refresh-db-password.timer") || !strings.Contains(userData, "APP_SERVICE='webapp'") {
+		t.Errorf("user data does not refresh the rotated password:\n%s", userData)
+	}
+
+	m = mustRunStack(t, map[string]string{
+		"db-password-mode":   "config",
+		"db-master-password": "test-password",
+	})
+	if password := m.resource(t, "db", "aws:rds/instance:Instance")["password"]; password.SecretValue().Element.StringValue() != "test-password" {
+		t.Errorf("db password = %v, want db-master-password", password)
+	}
+	m.resource(t, "db-master-password-secret", "aws:secretsmanager/secret:Secret")
+	m.resource(t, "db-master-password-secret-version", "aws:secretsmanager/secretVersion:SecretVersion")
+	policy = stringInput(m.resource(t, "db-password-secret-read-policy", "aws:iam/rolePolicy:RolePolicy"), "policy")
+	if !strings.Contains(policy, "db-master-password-secret") {
+		t.Errorf("secret read policy = %s, want it scoped to the config secret", policy)
+	}
+
+	if _, err := runStack(t, map[string]string{"db-password-mode": "config"}); err == nil {
+		t.Error("config mode without db-master-password did not fail")
+	}
+	if _, err := runStack(t, map[string]string{"db-password-mode": "managed", "app-service": "web app"}); err == nil || !strings.Contains(err.Error(), "app-service") {
+		t.Errorf("error = %v, want app-service rejected", err)
+	}
+}
+
+func TestCredentialsAreSecrets(t *testing.T) {
+	m := mustRunStack(t, map[string]string{"db-master-password": "test-password"})
+
+	vars := m.resource(t, "lambda-function", "aws:lambda/function:Function")["environment"].ObjectValue()["variables"].ObjectValue()
+	if !vars["SMTP_PASSWORD"].IsSecret() {
+		t.Errorf("SMTP_PASSWORD = %v, want a secret", vars["SMTP_PASSWORD"])
+	}
+	if db := m.resource(t, "db", "aws:rds/instance:Instance"); !db["password"].IsSecret() {
+		t.Errorf("db password = %v, want a secret", db["password"])
+	}
+	version := m.resource(t, "db-master-password-secret-version", "aws:secretsmanager/secretVersion:SecretVersion")
+	if !version["secretString"].IsSecret() {
+		t.Errorf("secretString = %v, want a secret", version["secretString"])
+	}
+	if strings.Contains(launchTemplateUserData(t, m), "test-password") {
+		t.Error("user data contains the database password")
+	}
+
+	_, err := runStackWithSecretKeys(t, map[string]string{
+		"db-password-mode":   "config",
+		"db-master-password": "test-password",
+	}, nil)
+	if err == nil {
+		t.Fatal("plaintext credentials did not fail")
+	}
+	for _, key := range testSecretKeys {
+		if !strings.Contains(err.Error(), key+": must be stored as a secret") {
+			t.Errorf("error does not reject plaintext %s: %v", key, err)
+		}
+	}
+}
+
+func TestInvalidConfigFailsBeforeResources(t *testing.T) {
+	m, err := runStack(t, map[string]string{
+		"vpc-cidr":        "10.0.0.0/33",
+		"db-storage-size": "0",
+		"ssh-key":         "",
+	})
+	if err == nil {
+		t.Fatal("invalid configuration did not fail")
+	}
+	for _, key := range []string{"vpc-cidr", "db-storage-size", "ssh-key"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+	if len(m.resources) != 0 {
+		t.Errorf("registered %d resources before failing", len(m.resources))
+	}
+}
@@ -0,0 +1,698 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/s3"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Network is the VPC and everything that lives directly in it: subnets,
+// gateways, route tables, endpoints, flow logs and the security groups of
+// each tier.
+type Network struct {
+	pulumi.ResourceState
+
+	Vpc                *ec2.Vpc
+	PublicSubnets      []*ec2.Subnet
+	PrivateSubnets     []*ec2.Subnet
+	IsolatedSubnets    []*ec2.Subnet
+	PublicRouteTable   *ec2.RouteTable
+	PrivateRouteTables []*ec2.RouteTable
+
+	LoadBalancerSecurityGroup *ec2.SecurityGroup
+	ApplicationSecurityGroup  *ec2.SecurityGroup
+	DatabaseSecurityGroup     *ec2.SecurityGroup
+	// BastionSecurityGroup is only set with bastion.
+	BastionSecurityGroup *ec2.SecurityGroup
+
+	VpcId            pulumi.IDOutput
+	PublicSubnetIds  pulumi.StringArrayOutput
+	PrivateSubnetIds pulumi.StringArrayOutput
+}
+
+// NetworkArgs are the inputs to NewNetwork.
+type NetworkArgs struct {
+	Config     *StackConfig
+	Zones      []string
+	SubnetPlan *SubnetPlan
+}
+
+// NewNetwork creates the VPC with one subnet per tier in each of args.Zones.
+func NewNetwork(ctx *pulumi.Context, name string, args *NetworkArgs, opts ...pulumi.ResourceOption) (*Network, error) {
+	network := &Network{}
+	err := ctx.RegisterComponentResource("csye6225:index:Network", name, network, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := args.Config
+	zones := args.Zones
+	subnetPlan := args.SubnetPlan
+
+	vpc, err := ec2.NewVpc(ctx, "vpc", &ec2.VpcArgs{
+		CidrBlock:          pulumi.String(cfg.VpcCidr),
+		EnableDnsSupport:   pulumi.Bool(true),
+		EnableDnsHostnames: pulumi.Bool(true),
+		// dual-stack VPCs get an Amazon-provided /56 IPv6 block
+		AssignGeneratedIpv6CidrBlock: pulumi.Bool(cfg.EnableIpv6),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("vpc-assign-5"),
+		},
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var publicSubnets []*ec2.Subnet
+	var privateSubnets []*ec2.Subnet
+	var isolatedSubnets []*ec2.Subnet
+
+	// ipv6Block returns the index-th /64 of the VPC's IPv6 block, or nil
+	// when the VPC is IPv4 only. Each tier owns maxAzCount indexes, so a
+	// subnet keeps its block when az-count changes.
+	ipv6Block := func(index int) pulumi.StringPtrInput {
+		if !cfg.EnableIpv6 {
+			return nil
+		}
+		return vpc.Ipv6CidrBlock.ApplyT(func(block string) (string, error) {
+			return ipv6SubnetCidr(block, index)
+		}).(pulumi.StringOutput)
+	}
+
+	for i, az := range zones {
+		publicSubnetName := "public-subnet-" + fmt.Sprintf("%d", i+1)
+		publicSubnet, err := ec2.NewSubnet(ctx, publicSubnetName, &ec2.SubnetArgs{
+			VpcId:                       vpc.ID(),
+			CidrBlock:                   pulumi.String(subnetPlan.Public[i]),
+			Ipv6CidrBlock:               ipv6Block(i),
+			AssignIpv6AddressOnCreation: pulumi.Bool(cfg.EnableIpv6),
+			MapPublicIpOnLaunch:         pulumi.Bool(true),
+			AvailabilityZone:            pulumi.String(az),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String(publicSubnetName),
+			},
+		}, childOptions(network)...)
+		publicSubnets = append(publicSubnets, publicSubnet)
+		if err != nil {
+			return nil, err
+		}
+		privateSubnetName := "private-subnet-" + fmt.Sprintf("%d", i+1)
+		privateSubnet, error := ec2.NewSubnet(ctx, privateSubnetName, &ec2.SubnetArgs{
+			VpcId:                       vpc.ID(),
+			CidrBlock:                   pulumi.String(subnetPlan.Private[i]),
+			Ipv6CidrBlock:               ipv6Block(maxAzCount + i),
+			AssignIpv6AddressOnCreation: pulumi.Bool(cfg.EnableIpv6),
+			MapPublicIpOnLaunch:         pulumi.Bool(false),
+			AvailabilityZone:            pulumi.String(az),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String(privateSubnetName),
+			},
+		}, childOptions(network)...)
+		privateSubnets = append(privateSubnets, privateSubnet)
+		if error != nil {
+			return nil, error
+		}
+		if len(subnetPlan.Isolated) == 0 {
+			continue
+		}
+		isolatedSubnetName := "isolated-subnet-" + fmt.Sprintf("%d", i+1)
+		isolatedSubnet, err := ec2.NewSubnet(ctx, isolatedSubnetName, &ec2.SubnetArgs{
+			VpcId:                       vpc.ID(),
+			CidrBlock:                   pulumi.String(subnetPlan.Isolated[i]),
+			Ipv6CidrBlock:               ipv6Block(2*maxAzCount + i),
+			AssignIpv6AddressOnCreation: pulumi.Bool(cfg.EnableIpv6),
+			MapPublicIpOnLaunch:         pulumi.Bool(false),
+			AvailabilityZone:            pulumi.String(az),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String(isolatedSubnetName),
+			},
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+		isolatedSubnets = append(isolatedSubnets, isolatedSubnet)
+	}
+
+	igw, err := ec2.NewInternetGateway(ctx, "internet-gateway", &ec2.InternetGatewayArgs{
+		VpcId: vpc.ID(),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("internet-gateway"),
+		},
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	publicRouteTable, err := ec2.NewRouteTable(ctx, "public-route-table", &ec2.RouteTableArgs{
+		VpcId: vpc.ID(),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("public-route-table"),
+		},
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// private subnets share one route table unless every AZ gets its own NAT gateway
+	var privateRouteTables []*ec2.RouteTable
+	if cfg.NatMode == natModePerAz {
+		for i := range zones {
+			privateRouteTableName := "private-route-table-" + fmt.Sprintf("%d", i+1)
+			privateRouteTable, err := ec2.NewRouteTable(ctx, privateRouteTableName, &ec2.RouteTableArgs{
+				VpcId: vpc.ID(),
+				Tags: pulumi.StringMap{
+					"course": courseTag,
+					"assign": assignmentTag,
+					"Name":   pulumi.String(privateRouteTableName),
+				},
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+			privateRouteTables = append(privateRouteTables, privateRouteTable)
+		}
+	} else {
+		privateRouteTable, err := ec2.NewRouteTable(ctx, "private-route-table", &ec2.RouteTableArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String("private-route-table"),
+			},
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+		for range zones {
+			privateRouteTables = append(privateRouteTables, privateRouteTable)
+		}
+	}
+
+	for i := range zones {
+		_, err := ec2.NewRouteTableAssociation(ctx, "public-route-table-assoc-"+fmt.Sprintf("%d", i+1), &ec2.RouteTableAssociationArgs{
+			SubnetId:     publicSubnets[i].ID(),
+			RouteTableId: publicRouteTable.ID(),
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range zones {
+		_, err := ec2.NewRouteTableAssociation(ctx, "private-route-table-assoc-"+fmt.Sprintf("%d", i+1), &ec2.RouteTableAssociationArgs{
+			SubnetId:     privateSubnets[i].ID(),
+			RouteTableId: privateRouteTables[i].ID(),
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// isolated subnets get their own route table with no routes beyond the VPC
+	var isolatedRouteTable *ec2.RouteTable
+	if len(isolatedSubnets) > 0 {
+		isolatedRouteTable, err = ec2.NewRouteTable(ctx, "isolated-route-table", &ec2.RouteTableArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String("isolated-route-table"),
+			},
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+		for i, subnet := range isolatedSubnets {
+			_, err := ec2.NewRouteTableAssociation(ctx, "isolated-route-table-assoc-"+fmt.Sprintf("%d", i+1), &ec2.RouteTableAssociationArgs{
+				SubnetId:     subnet.ID(),
+				RouteTableId: isolatedRouteTable.ID(),
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, err = ec2.NewRoute(ctx, "route-to-gateway", &ec2.RouteArgs{
+		RouteTableId:         publicRouteTable.ID(),
+		DestinationCidrBlock: pulumi.String(cfg.IgwRoute),
+		GatewayId:            igw.ID(),
+	}, childOptions(network)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.EnableIpv6 {
+		_, err = ec2.NewRoute(ctx, "route-to-gateway-ipv6", &ec2.RouteArgs{
+			RouteTableId:             publicRouteTable.ID(),
+			DestinationIpv6CidrBlock: pulumi.String("::/0"),
+			GatewayId:                igw.ID(),
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+
+		// private subnets reach the internet over IPv6 through an egress-only gateway
+		egressOnlyGateway, err := ec2.NewEgressOnlyInternetGateway(ctx, "egress-only-internet-gateway", &ec2.EgressOnlyInternetGatewayArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String("egress-only-internet-gateway"),
+			},
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+		routed := map[*ec2.RouteTable]bool{}
+		for i, routeTable := range privateRouteTables {
+			if routed[routeTable] {
+				continue
+			}
+			routed[routeTable] = true
+			suffix := ""
+			if cfg.NatMode == natModePerAz {
+				suffix = fmt.Sprintf("-%d", i+1)
+			}
+			_, err = ec2.NewRoute(ctx, "private-route-to-egress-only-gateway"+suffix, &ec2.RouteArgs{
+				RouteTableId:             routeTable.ID(),
+				DestinationIpv6CidrBlock: pulumi.String("::/0"),
+				EgressOnlyGatewayId:      egressOnlyGateway.ID(),
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// NAT gateways give the private subnets outbound internet access
+	var natGateways []*ec2.NatGateway
+	switch cfg.NatMode {
+	case natModeSingle:
+		natGateway, err := newNatGateway(ctx, "", publicSubnets[0], igw, network)
+		if err != nil {
+			return nil, err
+		}
+		natGateways = append(natGateways, natGateway)
+	case natModePerAz:
+		for i := range zones {
+			natGateway, err := newNatGateway(ctx, fmt.Sprintf("-%d", i+1), publicSubnets[i], igw, network)
+			if err != nil {
+				return nil, err
+			}
+			natGateways = append(natGateways, natGateway)
+		}
+	}
+	for i, natGateway := range natGateways {
+		suffix := ""
+		if cfg.NatMode == natModePerAz {
+			suffix = fmt.Sprintf("-%d", i+1)
+		}
+		_, err = ec2.NewRoute(ctx, "private-route-to-nat"+suffix, &ec2.RouteArgs{
+			RouteTableId:         privateRouteTables[i].ID(),
+			DestinationCidrBlock: pulumi.String(cfg.IgwRoute),
+			NatGatewayId:         natGateway.ID(),
+		}, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// VPC endpoints keep AWS API traffic on the AWS network
+	if len(cfg.GatewayEndpoints) > 0 || len(cfg.InterfaceEndpoints) > 0 {
+		region, err := aws.GetRegion(ctx, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		routeTableIds := pulumi.StringArray{publicRouteTable.ID()}
+		attached := map[*ec2.RouteTable]bool{}
+		for _, routeTable := range privateRouteTables {
+			if !attached[routeTable] {
+				attached[routeTable] = true
+				routeTableIds = append(routeTableIds, routeTable.ID())
+			}
+		}
+		if isolatedRouteTable != nil {
+			routeTableIds = append(routeTableIds, isolatedRouteTable.ID())
+		}
+
+		for _, service := range cfg.GatewayEndpoints {
+			endpointName := "vpc-endpoint-" + service
+			_, err := ec2.NewVpcEndpoint(ctx, endpointName, &ec2.VpcEndpointArgs{
+				VpcId:           vpc.ID(),
+				ServiceName:     pulumi.String(fmt.Sprintf("com.amazonaws.%s.%s", region.Name, service)),
+				VpcEndpointType: pulumi.String("Gateway"),
+				RouteTableIds:   routeTableIds,
+				Tags: pulumi.StringMap{
+					"course": courseTag,
+					"assign": assignmentTag,
+					"Name":   pulumi.String(endpointName),
+				},
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(cfg.InterfaceEndpoints) > 0 {
+			endpointSg, err := ec2.NewSecurityGroup(ctx, "vpc-endpoint-security-group", &ec2.SecurityGroupArgs{
+				VpcId:       vpc.ID(),
+				Description: pulumi.String("vpc interface endpoint security group"),
+				Ingress: ec2.SecurityGroupIngressArray{
+					&ec2.SecurityGroupIngressArgs{
+						Protocol:   pulumi.String("tcp"),
+						FromPort:   pulumi.Int(443),
+						ToPort:     pulumi.Int(443),
+						CidrBlocks: pulumi.StringArray{pulumi.String(cfg.VpcCidr)},
+					},
+				},
+				Tags: pulumi.StringMap{
+					"course": courseTag,
+					"assign": assignmentTag,
+					"Name":   pulumi.String("vpc-endpoint-security-group"),
+				},
+			}, childOptions(network)...)
+			if err != nil {
+				return nil, err
+			}
+
+			var endpointSubnetIds pulumi.StringArray
+			for _, subnet := range privateSubnets {
+				endpointSubnetIds = append(endpointSubnetIds, subnet.ID())
+			}
+			for _, service := range cfg.InterfaceEndpoints {
+				endpointName := "vpc-endpoint-" + service
+				_, err := ec2.NewVpcEndpoint(ctx, endpointName, &ec2.VpcEndpointArgs{
+					VpcId:             vpc.ID(),
+					ServiceName:       pulumi.String(fmt.Sprintf("com.amazonaws.%s.%s", region.Name, service)),
+					VpcEndpointType:   pulumi.String("Interface"),
+					PrivateDnsEnabled: pulumi.Bool(true),
+					SubnetIds:         endpointSubnetIds,
+					SecurityGroupIds:  pulumi.StringArray{endpointSg.ID()},
+					Tags: pulumi.StringMap{
+						"course": courseTag,
+						"assign": assignmentTag,
+						"Name":   pulumi.String(endpointName),
+					},
+				}, childOptions(network)...)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if cfg.FlowLogDestination != flowLogDestinationNone {
+		if err := newFlowLog(ctx, cfg, vpc, network); err != nil {
+			return nil, err
+		}
+	}
+
+	// without security-group-rules the ingress rules stay inline, where stacks
+	// created before the rule set have them: dropping inline rules from the
+	// program does not revoke them, and AWS refuses a standalone rule that
+	// duplicates one. Egress rules, and every configured rule, are their own
+	// SecurityGroupRule; a group never holds the same direction both ways.
+	inlineIngress := len(cfg.SecurityGroupRules) == 0
+	rules := cfg.securityGroupRules()
+	securityGroups := map[string]*ec2.SecurityGroup{}
+	// each group comes after the groups its inline rules refer to
+	for _, group := range []struct {
+		name        string
+		description string
+	}{
+		{securityGroupLoadBalancer, "load balancer security group"},
+		{securityGroupBastion, "bastion security group"},
+		{securityGroupApplication, "application security group"},
+		{securityGroupDatabase, ""},
+	} {
+		if group.name == securityGroupBastion && !cfg.Bastion {
+			continue
+		}
+		sgArgs := &ec2.SecurityGroupArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String(group.name + "-security-group"),
+			},
+		}
+		// the database group predates descriptions; setting one would replace it
+		if group.description != "" {
+			sgArgs.Description = pulumi.String(group.description)
+		}
+		if inlineIngress {
+			var ingress ec2.SecurityGroupIngressArray
+			for _, rule := range rules {
+				if rule.Group != group.name || rule.Direction != ruleDirectionIngress {
+					continue
+				}
+				// no description, so the rules match what older stacks have
+				args := &ec2.SecurityGroupIngressArgs{
+					Protocol: pulumi.String(rule.Protocol),
+					FromPort: pulumi.Int(rule.FromPort),
+					ToPort:   pulumi.Int(rule.ToPort),
+				}
+				if rule.SourceGroup != "" {
+					args.SecurityGroups = pulumi.StringArray{securityGroups[rule.SourceGroup].ID()}
+				}
+				if len(rule.CidrBlocks) > 0 {
+					args.CidrBlocks = pulumi.ToStringArray(rule.CidrBlocks)
+				}
+				if len(rule.Ipv6CidrBlocks) > 0 {
+					args.Ipv6CidrBlocks = pulumi.ToStringArray(rule.Ipv6CidrBlocks)
+				}
+				ingress = append(ingress, args)
+			}
+			sgArgs.Ingress = ingress
+		}
+		sg, err := ec2.NewSecurityGroup(ctx, group.name+"-security-group", sgArgs, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+		securityGroups[group.name] = sg
+	}
+
+	for _, rule := range rules {
+		if inlineIngress && rule.Direction == ruleDirectionIngress {
+			continue
+		}
+		ruleArgs := &ec2.SecurityGroupRuleArgs{
+			SecurityGroupId: securityGroups[rule.Group].ID(),
+			Type:            pulumi.String(rule.Direction),
+			Protocol:        pulumi.String(rule.Protocol),
+			FromPort:        pulumi.Int(rule.FromPort),
+			ToPort:          pulumi.Int(rule.ToPort),
+		}
+		if rule.Description != "" {
+			ruleArgs.Description = pulumi.String(rule.Description)
+		}
+		if rule.SourceGroup != "" {
+			ruleArgs.SourceSecurityGroupId = securityGroups[rule.SourceGroup].ID()
+		}
+		if len(rule.CidrBlocks) > 0 {
+			ruleArgs.CidrBlocks = pulumi.ToStringArray(rule.CidrBlocks)
+		}
+		if len(rule.Ipv6CidrBlocks) > 0 {
+			ruleArgs.Ipv6CidrBlocks = pulumi.ToStringArray(rule.Ipv6CidrBlocks)
+		}
+		if len(rule.PrefixListIds) > 0 {
+			ruleArgs.PrefixListIds = pulumi.ToStringArray(rule.PrefixListIds)
+		}
+		_, err = ec2.NewSecurityGroupRule(ctx, rule.resourceName(), ruleArgs, childOptions(network)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var publicSubnetIds, privateSubnetIds pulumi.StringArray
+	for _, subnet := range publicSubnets {
+		publicSubnetIds = append(publicSubnetIds, subnet.ID())
+	}
+	for _, subnet := range privateSubnets {
+		privateSubnetIds = append(privateSubnetIds, subnet.ID())
+	}
+
+	network.Vpc = vpc
+	network.PublicSubnets = publicSubnets
+	network.PrivateSubnets = privateSubnets
+	network.IsolatedSubnets = isolatedSubnets
+	network.PublicRouteTable = publicRouteTable
+	network.PrivateRouteTables = privateRouteTables
+	network.LoadBalancerSecurityGroup = securityGroups[securityGroupLoadBalancer]
+	network.ApplicationSecurityGroup = securityGroups[securityGroupApplication]
+	network.DatabaseSecurityGroup = securityGroups[securityGroupDatabase]
+	network.BastionSecurityGroup = securityGroups[securityGroupBastion]
+	network.VpcId = vpc.ID()
+	network.PublicSubnetIds = publicSubnetIds.ToStringArrayOutput()
+	network.PrivateSubnetIds = privateSubnetIds.ToStringArrayOutput()
+
+	err = ctx.RegisterResourceOutputs(network, pulumi.Map{
+		"vpcId":            network.VpcId,
+		"publicSubnetIds":  network.PublicSubnetIds,
+		"privateSubnetIds": network.PrivateSubnetIds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+// newNatGateway allocates an Elastic IP and places a NAT gateway in the given
+// public subnet. suffix distinguishes per-AZ gateways, e.g. "-1".
+func newNatGateway(ctx *pulumi.Context, suffix string, subnet *ec2.Subnet, igw *ec2.InternetGateway, parent pulumi.Resource) (*ec2.NatGateway, error) {
+	eip, err := ec2.NewEip(ctx, "nat-eip"+suffix, &ec2.EipArgs{
+		Domain: pulumi.String("vpc"),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("nat-eip" + suffix),
+		},
+	}, childOptions(parent, pulumi.DependsOn([]pulumi.Resource{igw}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec2.NewNatGateway(ctx, "nat-gateway"+suffix, &ec2.NatGatewayArgs{
+		AllocationId: eip.ID(),
+		SubnetId:     subnet.ID(),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("nat-gateway" + suffix),
+		},
+	}, childOptions(parent, pulumi.DependsOn([]pulumi.Resource{igw}))...)
+}
+
+// newFlowLog ships flow logs for the VPC to a CloudWatch log group or an S3
+// bucket, creating the destination and the IAM role delivery needs.
+func newFlowLog(ctx *pulumi.Context, cfg *StackConfig, vpc *ec2.Vpc, parent pulumi.Resource) error {
+	args := &ec2.FlowLogArgs{
+		VpcId:              vpc.ID(),
+		TrafficType:        pulumi.String(cfg.FlowLogTrafficType),
+		LogDestinationType: pulumi.String(cfg.FlowLogDestination),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("vpc-flow-log"),
+		},
+	}
+	if cfg.FlowLogFormat != "" {
+		args.LogFormat = pulumi.String(cfg.FlowLogFormat)
+	}
+
+	switch cfg.FlowLogDestination {
+	case flowLogDestinationCloudWatch:
+		logGroup, err := cloudwatch.NewLogGroup(ctx, "vpc-flow-log-group", &cloudwatch.LogGroupArgs{
+			Name:            pulumi.String(ctx.Stack() + "-vpc-flow-log-group"),
+			RetentionInDays: pulumi.Int(cfg.FlowLogRetentionDays),
+		}, childOptions(parent)...)
+		if err != nil {
+			return err
+		}
+
+		assumeRolePolicy, err := json.Marshal(map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Action": "sts:AssumeRole",
+					"Effect": "Allow",
+					"Principal": map[string]interface{}{
+						"Service": "vpc-flow-logs.amazonaws.com",
+					},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		role, err := iam.NewRole(ctx, "vpc-flow-log-role", &iam.RoleArgs{
+			AssumeRolePolicy: pulumi.String(string(assumeRolePolicy)),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String("vpc-flow-log-role"),
+			},
+		}, childOptions(parent)...)
+		if err != nil {
+			return err
+		}
+
+		_, err = iam.NewRolePolicy(ctx, "vpc-flow-log-policy", &iam.RolePolicyArgs{
+			Role: role.ID(),
+			Policy: logGroup.Arn.ApplyT(func(arn string) (string, error) {
+				policy, err := json.Marshal(map[string]interface{}{
+					"Version": "2012-10-17",
+					"Statement": []map[string]interface{}{
+						{
+							"Effect": "Allow",
+							"Action": []string{
+								"logs:CreateLogStream",
+								"logs:PutLogEvents",
+								"logs:DescribeLogGroups",
+								"logs:DescribeLogStreams",
+							},
+							"Resource": []string{arn, arn + ":*"},
+						},
+					},
+				})
+				return string(policy), err
+			}).(pulumi.StringOutput),
+		}, childOptions(parent)...)
+		if err != nil {
+			return err
+		}
+
+		args.LogDestination = logGroup.Arn
+		args.IamRoleArn = role.Arn
+
+	case flowLogDestinationS3:
+		if cfg.FlowLogBucketArn != "" {
+			args.LogDestination = pulumi.String(cfg.FlowLogBucketArn)
+			break
+		}
+		bucket, err := s3.NewBucketV2(ctx, "vpc-flow-log-bucket", &s3.BucketV2Args{
+			BucketPrefix: pulumi.String("vpc-flow-logs-"),
+			ForceDestroy: pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"course": courseTag,
+				"assign": assignmentTag,
+				"Name":   pulumi.String("vpc-flow-log-bucket"),
+			},
+		}, childOptions(parent)...)
+		if err != nil {
+			return err
+		}
+		_, err = s3.NewBucketPublicAccessBlock(ctx, "vpc-flow-log-bucket-public-access-block", &s3.BucketPublicAccessBlockArgs{
+			Bucket:                bucket.ID(),
+			BlockPublicAcls:       pulumi.Bool(true),
+			BlockPublicPolicy:     pulumi.Bool(true),
+			IgnorePublicAcls:      pulumi.Bool(true),
+			RestrictPublicBuckets: pulumi.Bool(true),
+		}, childOptions(parent)...)
+		if err != nil {
+			return err
+		}
+		args.LogDestination = bucket.Arn
+	}
+
+	_, err := ec2.NewFlowLog(ctx, "vpc-flow-log", args, childOptions(parent)...)
+	return err
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/dynamodb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sns"
+	"github.com/pulumi/pulumi-gcp/sdk/v7/go/gcp/serviceaccount"
+	"github.com/pulumi/pulumi-gcp/sdk/v7/go/gcp/storage"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// SubmissionPipeline handles assignment submissions: an SNS topic triggers a
+// Lambda that stores the submission in a GCS bucket, records it in DynamoDB
+// and emails the student.
+type SubmissionPipeline struct {
+	pulumi.ResourceState
+
+	Topic    *sns.Topic
+	Function *lambda.Function
+
+	TopicArn    pulumi.StringOutput
+	TableName   pulumi.StringOutput
+	BucketName  pulumi.StringOutput
+	FunctionArn pulumi.StringOutput
+}
+
+// lambdaFunctionName is the name of the submission Lambda, which also names
+// its log group.
+const lambdaFunctionName = "csye-submissions-lambda"
+
+// SubmissionPipelineArgs are the inputs to NewSubmissionPipeline.
+type SubmissionPipelineArgs struct {
+	Config *StackConfig
+}
+
+// NewSubmissionPipeline creates the GCP and AWS resources of the pipeline.
+func NewSubmissionPipeline(ctx *pulumi.Context, name string, args *SubmissionPipelineArgs, opts ...pulumi.ResourceOption) (*SubmissionPipeline, error) {
+	pipeline := &SubmissionPipeline{}
+	err := ctx.RegisterComponentResource("csye6225:index:SubmissionPipeline", name, pipeline, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := args.Config
+
+	service_account, err := serviceaccount.NewAccount(ctx, "aws-lambda-service-account", &serviceaccount.AccountArgs{
+		AccountId:   pulumi.String("aws-lambda-service-account"),
+		DisplayName: pulumi.String("aws-lambda-service-account"),
+		Project:     pulumi.String(cfg.GcpProjectId),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	sa_access_key, err := serviceaccount.NewKey(ctx, "service-account-access-key", &serviceaccount.KeyArgs{
+		ServiceAccountId: service_account.Name,
+		PublicKeyType:    pulumi.String("TYPE_X509_PEM_FILE"),
+	}, childOptions(pipeline, pulumi.AdditionalSecretOutputs([]string{"privateKey"}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	newUUID := uuid.New()
+	uuidStr := newUUID.String()
+
+	gcp_bucket, err := storage.NewBucket(ctx, "gcp-bucket", &storage.BucketArgs{
+		Project:                  pulumi.String(cfg.GcpProjectId),
+		Name:                     pulumi.String("csyebucket" + uuidStr),
+		PublicAccessPrevention:   pulumi.String("enforced"),
+		Location:                 pulumi.String("US"),
+		StorageClass:             pulumi.String("STANDARD"),
+		ForceDestroy:             pulumi.Bool(true),
+		UniformBucketLevelAccess: pulumi.Bool(true),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = storage.NewBucketIAMBinding(ctx, "bucket-iam", &storage.BucketIAMBindingArgs{
+		Bucket: gcp_bucket.Name,
+		Role:   pulumi.String(cfg.GcpCloudStorageRole),
+		Members: pulumi.StringArray{
+			service_account.Email.ApplyT(func(args interface{}) (string, error) {
+				email := args.(string)
+				return "serviceAccount:" + email, nil
+			}).(pulumi.StringOutput),
+		},
+	}, childOptions(pipeline, pulumi.DependsOn([]pulumi.Resource{service_account, gcp_bucket}))...)
+	if err != nil {
+		return nil, err
+
+	}
+
+	sns_topic, err := sns.NewTopic(ctx, "csye6225-submissions", &sns.TopicArgs{
+		Name: pulumi.String("csye6225-submissions"),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	lambda_role, _ := iam.NewRole(ctx, "lambda-role", &iam.RoleArgs{
+		Name: pulumi.String("lambda-role"),
+		AssumeRolePolicy: pulumi.String(`{
+				"Version": "2012-10-17",
+				"Statement": [
+					{
+						"Action": "sts:AssumeRole",
+						"Principal": {
+							"Service": "lambda.amazonaws.com"
+							
+					},
+						"Effect": "Allow",
+						"Sid": ""
+					}
+				]
+			}`),
+	}, childOptions(pipeline)...)
+
+	lambda_loggroup, err := cloudwatch.NewLogGroup(ctx, "lambda-log-group", &cloudwatch.LogGroupArgs{
+		RetentionInDays: pulumi.Int(14),
+		Name:            pulumi.String("lambda-log-group"),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lambda writes to /aws/lambda/<function name> and creates that group on
+	// first use, so the policy names it by ARN rather than managing it; an
+	// existing group is left alone
+	partition, err := aws.GetPartition(ctx, nil, pulumi.Parent(pipeline))
+	if err != nil {
+		return nil, err
+	}
+	region, err := aws.GetRegion(ctx, nil, pulumi.Parent(pipeline))
+	if err != nil {
+		return nil, err
+	}
+	caller, err := aws.GetCallerIdentity(ctx, nil, pulumi.Parent(pipeline))
+	if err != nil {
+		return nil, err
+	}
+	functionLogGroupArn := fmt.Sprintf("arn:%s:logs:%s:%s:log-group:/aws/lambda/%s", partition.Partition, region.Name, caller.AccountId, lambdaFunctionName)
+	lambda_logging_policy_document := iam.GetPolicyDocumentOutput(ctx, iam.GetPolicyDocumentOutputArgs{
+		Statements: iam.GetPolicyDocumentStatementArray{
+			&iam.GetPolicyDocumentStatementArgs{
+				Effect: pulumi.String("Allow"),
+				Actions: pulumi.StringArray{
+					pulumi.String("logs:CreateLogGroup"),
+				},
+				Resources: pulumi.StringArray{
+					pulumi.String(functionLogGroupArn),
+				},
+			},
+			&iam.GetPolicyDocumentStatementArgs{
+				Effect: pulumi.String("Allow"),
+				Actions: pulumi.StringArray{
+					pulumi.String("logs:CreateLogStream"),
+					pulumi.String("logs:PutLogEvents"),
+				},
+				Resources: pulumi.StringArray{
+					pulumi.String(functionLogGroupArn + ":*"),
+				},
+			},
+		},
+	})
+
+	lambda_logging_policy, err := iam.NewPolicy(ctx, "lambda-logging-policy", &iam.PolicyArgs{
+		Path:        pulumi.String("/"),
+		Description: pulumi.String("IAM policy for logging from a lambda"),
+		Policy:      lambda_logging_policy_document.Json(),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	lambda_logs, err := iam.NewRolePolicyAttachment(ctx, "lambdaLogs", &iam.RolePolicyAttachmentArgs{
+		Role:      lambda_role.Name,
+		PolicyArn: lambda_logging_policy.Arn,
+	}, childOptions(pipeline, pulumi.DependsOn([]pulumi.Resource{
+		lambda_role,
+		lambda_logging_policy,
+	}))...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dynamodb, err := dynamodb.NewTable(ctx, "dynamodb", &dynamodb.TableArgs{
+		Name: pulumi.String("csye6225-submissions-table"),
+		Attributes: dynamodb.TableAttributeArray{
+			&dynamodb.TableAttributeArgs{
+				Name: pulumi.String("id"),
+				Type: pulumi.String("S"),
+			},
+		},
+		HashKey:       pulumi.String("id"),
+		ReadCapacity:  pulumi.Int(5),
+		WriteCapacity: pulumi.Int(5),
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("dynamodb"),
+		},
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamodb_policy_document := iam.GetPolicyDocumentOutput(ctx, iam.GetPolicyDocumentOutputArgs{
+		Statements: iam.GetPolicyDocumentStatementArray{
+			&iam.GetPolicyDocumentStatementArgs{
+				Effect: pulumi.String("Allow"),
+				Actions: pulumi.StringArray{
+					pulumi.String("dynamodb:GetItem"),
+					pulumi.String("dynamodb:PutItem"),
+					pulumi.String("dynamodb:UpdateItem"),
+					pulumi.String("dynamodb:DeleteItem"),
+					pulumi.String("dynamodb:Scan"),
+					pulumi.String("dynamodb:Query"),
+				},
+				Resources: pulumi.StringArray{
+					dynamodb.Arn,
+				},
+			},
+		},
+	})
+
+	dynamodb_policy, err := iam.NewPolicy(ctx, "dynamodb-policy", &iam.PolicyArgs{
+		Path:        pulumi.String("/"),
+		Description: pulumi.String("IAM policy for dynamodb"),
+		Policy:      dynamodb_policy_document.Json(),
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamodb_policy_attachment, err := iam.NewRolePolicyAttachment(ctx, "dynamodb-policy-attachment", &iam.RolePolicyAttachmentArgs{
+		Role:      lambda_role.Name,
+		PolicyArn: dynamodb_policy.Arn,
+	}, childOptions(pipeline, pulumi.DependsOn([]pulumi.Resource{
+		lambda_role,
+		dynamodb_policy,
+	}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	lambda_function, err := lambda.NewFunction(ctx, "lambda-function", &lambda.FunctionArgs{
+		Name:    pulumi.String(lambdaFunctionName),
+		Handler: pulumi.String(cfg.LambdaHandler),
+		Role:    lambda_role.Arn,
+		Runtime: pulumi.String("python3.11"),
+		Code:    pulumi.NewFileArchive(cfg.LambdaDeploymentPath),
+		Environment: &lambda.FunctionEnvironmentArgs{
+			Variables: pulumi.StringMap{
+				"BUCKET_NAME":        gcp_bucket.Name,
+				"GOOGLE_CREDENTIALS": sa_access_key.PrivateKey,
+				"DYNAMODB_TABLE":     dynamodb.Name,
+				"SMTP_HOST":          pulumi.String(cfg.SmtpHost),
+				"SMTP_PORT":          pulumi.String(strconv.Itoa(cfg.SmtpPort)),
+				"SMTP_USERNAME":      pulumi.String(cfg.SmtpUser),
+				"SMTP_PASSWORD":      cfg.SmtpPassword,
+				"SENDER_EMAIL":       pulumi.String(cfg.SenderEmail),
+			},
+		},
+		Timeout: pulumi.Int(10),
+	}, childOptions(pipeline, pulumi.DependsOn([]pulumi.Resource{
+		lambda_logs,
+		lambda_loggroup,
+		dynamodb_policy_attachment,
+	}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = lambda.NewPermission(ctx, "withSns", &lambda.PermissionArgs{
+		Action:    pulumi.String("lambda:InvokeFunction"),
+		Function:  lambda_function.Name,
+		Principal: pulumi.String("sns.amazonaws.com"),
+		SourceArn: sns_topic.Arn,
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = sns.NewTopicSubscription(ctx, "lambda-subscription", &sns.TopicSubscriptionArgs{
+		Protocol: pulumi.String("lambda"),
+		Topic:    sns_topic.Arn,
+		Endpoint: lambda_function.Arn,
+	}, childOptions(pipeline)...)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline.Topic = sns_topic
+	pipeline.Function = lambda_function
+	pipeline.TopicArn = sns_topic.Arn
+	pipeline.TableName = dynamodb.Name
+	pipeline.BucketName = gcp_bucket.Name
+	pipeline.FunctionArn = lambda_function.Arn
+
+	err = ctx.RegisterResourceOutputs(pipeline, pulumi.Map{
+		"topicArn":    pipeline.TopicArn,
+		"tableName":   pipeline.TableName,
+		"bucketName":  pipeline.BucketName,
+		"functionArn": pipeline.FunctionArn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
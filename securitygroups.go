@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SecurityGroupRule is one entry of security-group-rules. Group is the
+// security group the rule belongs to; the peer is given by exactly one of the
+// CIDR lists, SourceGroup or PrefixListIds, and for egress it is where the
+// traffic goes. ToPort defaults to FromPort for tcp and udp. Name is the
+// resource name; left empty, one is derived from the rule.
+type SecurityGroupRule struct {
+	Name           string   `json:"name"`
+	Group          string   `json:"group"`
+	Direction      string   `json:"direction"`
+	Protocol       string   `json:"protocol"`
+	FromPort       int      `json:"from-port"`
+	ToPort         int      `json:"to-port"`
+	CidrBlocks     []string `json:"cidr-blocks"`
+	Ipv6CidrBlocks []string `json:"ipv6-cidr-blocks"`
+	SourceGroup    string   `json:"source-group"`
+	PrefixListIds  []string `json:"prefix-list-ids"`
+	Description    string   `json:"description"`
+}
+
+// The security groups rules may belong to or refer to. Each is created as
+// "<name>-security-group".
+const (
+	securityGroupLoadBalancer = "load-balancer"
+	securityGroupApplication  = "application"
+	securityGroupDatabase     = "database"
+	securityGroupBastion      = "bastion"
+)
+
+// Values accepted for the direction and protocol of a rule.
+const (
+	ruleDirectionIngress = "ingress"
+	ruleDirectionEgress  = "egress"
+
+	ruleProtocolTcp    = "tcp"
+	ruleProtocolUdp    = "udp"
+	ruleProtocolIcmp   = "icmp"
+	ruleProtocolIcmpv6 = "icmpv6"
+	ruleProtocolAll    = "all"
+)
+
+// resourceName is rule.Name or, without one, a name built from the group,
+// direction, protocol, ports and peer, so a rule keeps its name while the
+// list around it changes.
+func (rule SecurityGroupRule) resourceName() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	ports := fmt.Sprintf("%d-%d", rule.FromPort, rule.ToPort)
+	switch {
+	case rule.Protocol == ruleProtocolAll:
+		ports = "all"
+	case rule.FromPort == rule.ToPort:
+		ports = fmt.Sprint(rule.FromPort)
+	}
+	// CIDR blocks do not make good resource names
+	peer := rule.SourceGroup
+	if peer == "" {
+		sum := sha256.Sum256([]byte(strings.Join(rule.CidrBlocks, ",") + ";" +
+			strings.Join(rule.Ipv6CidrBlocks, ",") + ";" + strings.Join(rule.PrefixListIds, ",")))
+		peer = hex.EncodeToString(sum[:4])
+	}
+	return strings.Join([]string{rule.Group, rule.Direction, rule.Protocol, ports, peer}, "-")
+}
+
+// securityGroupRules is security-group-rules or, when that is not set, the
+// rules built from ports, alb-ports, ipv4-cidr, ipv6-cidr, db-port and the
+// bastion settings.
+func (c *StackConfig) securityGroupRules() []SecurityGroupRule {
+	if len(c.SecurityGroupRules) > 0 {
+		return c.SecurityGroupRules
+	}
+
+	tcp := func(group, direction string, port int, description string) SecurityGroupRule {
+		return SecurityGroupRule{
+			Group:       group,
+			Direction:   direction,
+			Protocol:    ruleProtocolTcp,
+			FromPort:    port,
+			ToPort:      port,
+			Description: description,
+		}
+	}
+	var rules []SecurityGroupRule
+	for _, port := range c.AlbPorts {
+		rule := tcp(securityGroupLoadBalancer, ruleDirectionIngress, port, "web traffic")
+		rule.CidrBlocks = []string{c.Ipv4Cidr}
+		rule.Ipv6CidrBlocks = []string{c.Ipv6Cidr}
+		rules = append(rules, rule)
+	}
+	for _, port := range c.Ports {
+		rule := tcp(securityGroupApplication, ruleDirectionIngress, port, "traffic from the load balancer")
+		rule.SourceGroup = securityGroupLoadBalancer
+		rules = append(rules, rule)
+	}
+	rule := tcp(securityGroupDatabase, ruleDirectionIngress, c.DbPort, "database connections from the application")
+	rule.SourceGroup = securityGroupApplication
+	rules = append(rules, rule)
+
+	// the egress rules keep the names they had before the rule set existed,
+	// so upgraded stacks do not replace them
+	rule = tcp(securityGroupApplication, ruleDirectionEgress, c.DbPort, "database connections")
+	rule.Name = "application-security-group-egress-rule"
+	rule.SourceGroup = securityGroupDatabase
+	rules = append(rules, rule)
+	rule = tcp(securityGroupLoadBalancer, ruleDirectionEgress, 8080, "requests and health checks to the application")
+	rule.Name = "alb-to-asg-healthcheck-egress"
+	rule.SourceGroup = securityGroupApplication
+	rules = append(rules, rule)
+	rule = tcp(securityGroupApplication, ruleDirectionEgress, 443, "HTTPS to AWS APIs and the internet")
+	rule.Name = "application-security-group-port-egress-rule"
+	rule.CidrBlocks = []string{c.Ipv4Cidr}
+	rule.Ipv6CidrBlocks = []string{c.Ipv6Cidr}
+	rules = append(rules, rule)
+
+	// the bastion accepts SSH from the admin CIDRs only and may only reach
+	// SSH and the application port on the instances, and the database port
+	if c.Bastion {
+		rule = tcp(securityGroupBastion, ruleDirectionIngress, 22, "SSH from the admin CIDRs")
+		for _, cidr := range c.BastionAdminCidrs {
+			if ip, _, _ := net.ParseCIDR(cidr); ip.To4() != nil {
+				rule.CidrBlocks = append(rule.CidrBlocks, cidr)
+			} else {
+				rule.Ipv6CidrBlocks = append(rule.Ipv6CidrBlocks, cidr)
+			}
+		}
+		rules = append(rules, rule)
+		rule = tcp(securityGroupApplication, ruleDirectionIngress, 22, "SSH from the bastion")
+		rule.SourceGroup = securityGroupBastion
+		rules = append(rules, rule)
+		rule = tcp(securityGroupApplication, ruleDirectionIngress, 8080, "traffic from the bastion")
+		rule.SourceGroup = securityGroupBastion
+		rules = append(rules, rule)
+		rule = tcp(securityGroupDatabase, ruleDirectionIngress, c.DbPort, "database connections from the bastion")
+		rule.SourceGroup = securityGroupBastion
+		rules = append(rules, rule)
+		rule = tcp(securityGroupBastion, ruleDirectionEgress, 8080, "traffic to the application")
+		rule.Name = "bastion-to-application-egress"
+		rule.SourceGroup = securityGroupApplication
+		rules = append(rules, rule)
+		rule = tcp(securityGroupBastion, ruleDirectionEgress, 22, "SSH to the application")
+		rule.Name = "bastion-to-application-ssh-egress"
+		rule.SourceGroup = securityGroupApplication
+		rules = append(rules, rule)
+		rule = tcp(securityGroupBastion, ruleDirectionEgress, c.DbPort, "database connections")
+		rule.Name = "bastion-to-database-egress"
+		rule.SourceGroup = securityGroupDatabase
+		rules = append(rules, rule)
+	}
+	return rules
+}
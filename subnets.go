@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// SubnetPrefixes holds the prefix length used for each subnet tier. A prefix
+// of 0 disables the tier.
+type SubnetPrefixes struct {
+	Public   int
+	Private  int
+	Isolated int
+}
+
+// SubnetPlan holds the CIDR blocks for each tier, one entry per AZ.
+type SubnetPlan struct {
+	Public   []string
+	Private  []string
+	Isolated []string
+}
+
+// Every tier has a fixed slot for each of up to maxAzCount zones, so changing
+// az-count adds or removes subnets without moving the others. The first
+// legacyAzCount slots of each tier come first, in the layout the stack had
+// before az-count existed; the remaining slots follow in a second round.
+const (
+	legacyAzCount = 3
+	maxAzCount    = 6
+)
+
+// planSubnets carves vpcCidr into azCount subnets per tier. Each round lays
+// the tiers out back to back in the order public, private, isolated, each
+// block aligned to its own prefix length. With /24 tiers the first round
+// reproduces the original layout: public x.x.0-2.0/24 and private
+// x.x.3-5.0/24.
+func planSubnets(vpcCidr string, prefixes SubnetPrefixes, azCount int) (*SubnetPlan, error) {
+	_, vpcNet, err := net.ParseCIDR(vpcCidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VPC CIDR %q: %w", vpcCidr, err)
+	}
+	ip := vpcNet.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("VPC CIDR %q is not an IPv4 block", vpcCidr)
+	}
+	if azCount < 1 || azCount > maxAzCount {
+		return nil, fmt.Errorf("AZ count must be between 1 and %d, got %d", maxAzCount, azCount)
+	}
+
+	vpcBits, _ := vpcNet.Mask.Size()
+	start := uint64(binary.BigEndian.Uint32(ip))
+	end := start + 1<<(32-vpcBits)
+	cursor := start
+
+	plan := &SubnetPlan{}
+	tiers := []struct {
+		name   string
+		prefix int
+		cidrs  *[]string
+	}{
+		{"public", prefixes.Public, &plan.Public},
+		{"private", prefixes.Private, &plan.Private},
+		{"isolated", prefixes.Isolated, &plan.Isolated},
+	}
+	for _, tier := range tiers {
+		if tier.prefix != 0 && (tier.prefix < vpcBits || tier.prefix > 28) {
+			return nil, fmt.Errorf("%s subnet prefix /%d must be between /%d and /28 for VPC %s", tier.name, tier.prefix, vpcBits, vpcCidr)
+		}
+	}
+
+	for _, round := range [][2]int{{0, legacyAzCount}, {legacyAzCount, maxAzCount}} {
+		for _, tier := range tiers {
+			if tier.prefix == 0 {
+				continue
+			}
+			size := uint64(1) << (32 - tier.prefix)
+			cursor = (cursor + size - 1) / size * size
+			for zone := round[0]; zone < round[1]; zone, cursor = zone+1, cursor+size {
+				// slots of unused zones only hold their place
+				if zone >= azCount {
+					continue
+				}
+				if cursor+size > end {
+					return nil, fmt.Errorf("VPC %s is too small: the %s subnet of zone %d (/%d) does not fit after the slots of the preceding tiers", vpcCidr, tier.name, zone+1, tier.prefix)
+				}
+				subnet := make(net.IP, 4)
+				binary.BigEndian.PutUint32(subnet, uint32(cursor))
+				*tier.cidrs = append(*tier.cidrs, fmt.Sprintf("%s/%d", subnet, tier.prefix))
+			}
+		}
+	}
+	return plan, nil
+}
+
+// ipv6SubnetCidr returns the index-th /64 inside an Amazon-provided /56 VPC
+// block, the only subnet size AWS allows for IPv6.
+func ipv6SubnetCidr(vpcBlock string, index int) (string, error) {
+	_, vpcNet, err := net.ParseCIDR(vpcBlock)
+	if err != nil {
+		return "", fmt.Errorf("invalid VPC IPv6 block %q: %w", vpcBlock, err)
+	}
+	bits, _ := vpcNet.Mask.Size()
+	if vpcNet.IP.To4() != nil || bits > 64 {
+		return "", fmt.Errorf("VPC IPv6 block %q must be an IPv6 prefix of /64 or shorter", vpcBlock)
+	}
+	if index < 0 || index >= 1<<(64-bits) {
+		return "", fmt.Errorf("subnet index %d does not fit in VPC IPv6 block %q", index, vpcBlock)
+	}
+
+	subnet := make(net.IP, net.IPv6len)
+	copy(subnet, vpcNet.IP)
+	prefix := binary.BigEndian.Uint64(subnet[:8]) | uint64(index)
+	binary.BigEndian.PutUint64(subnet[:8], prefix)
+	return fmt.Sprintf("%s/64", subnet), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanSubnets(t *testing.T) {
+	tests := []struct {
+		name     string
+		vpc      string
+		prefixes SubnetPrefixes
+		azCount  int
+		want     *SubnetPlan
+	}{
+		{
+			name:     "default layout",
+			vpc:      "10.0.0.0/16",
+			prefixes: SubnetPrefixes{Public: 24, Private: 24},
+			azCount:  3,
+			want: &SubnetPlan{
+				Public:  []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"},
+				Private: []string{"10.0.3.0/24", "10.0.4.0/24", "10.0.5.0/24"},
+			},
+		},
+		{
+			name:     "isolated tier",
+			vpc:      "10.1.0.0/16",
+			prefixes: SubnetPrefixes{Public: 24, Private: 24, Isolated: 26},
+			azCount:  2,
+			want: &SubnetPlan{
+				Public:   []string{"10.1.0.0/24", "10.1.1.0/24"},
+				Private:  []string{"10.1.3.0/24", "10.1.4.0/24"},
+				Isolated: []string{"10.1.6.0/26", "10.1.6.64/26"},
+			},
+		},
+		{
+			name:     "zones past the original three",
+			vpc:      "10.0.0.0/16",
+			prefixes: SubnetPrefixes{Public: 24, Private: 24},
+			azCount:  5,
+			want: &SubnetPlan{
+				Public:  []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.6.0/24", "10.0.7.0/24"},
+				Private: []string{"10.0.3.0/24", "10.0.4.0/24", "10.0.5.0/24", "10.0.9.0/24", "10.0.10.0/24"},
+			},
+		},
+		{
+			name:     "larger tier is aligned",
+			vpc:      "10.0.0.0/22",
+			prefixes: SubnetPrefixes{Public: 26, Private: 24},
+			azCount:  2,
+			want: &SubnetPlan{
+				Public:  []string{"10.0.0.0/26", "10.0.0.64/26"},
+				Private: []string{"10.0.1.0/24", "10.0.2.0/24"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planSubnets(tt.vpc, tt.prefixes, tt.azCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planSubnets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanSubnetsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		vpc      string
+		prefixes SubnetPrefixes
+		azCount  int
+		want     string
+	}{
+		{"vpc too small", "10.0.0.0/24", SubnetPrefixes{Public: 26, Private: 26}, 3, "too small"},
+		{"prefix wider than vpc", "10.0.0.0/24", SubnetPrefixes{Public: 20, Private: 26}, 1, "must be between /24 and /28"},
+		{"not a cidr", "10.0.0.0", SubnetPrefixes{Public: 24, Private: 24}, 1, "invalid VPC CIDR"},
+		{"no zones", "10.0.0.0/16", SubnetPrefixes{Public: 24, Private: 24}, 0, "between 1 and 6"},
+		{"too many zones", "10.0.0.0/16", SubnetPrefixes{Public: 24, Private: 24}, 7, "between 1 and 6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := planSubnets(tt.vpc, tt.prefixes, tt.azCount)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("planSubnets() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestPlanSubnetsAddZone checks that raising az-count only adds subnets: every
+// existing subnet keeps its CIDR, so none is replaced.
+func TestPlanSubnetsAddZone(t *testing.T) {
+	prefixes := SubnetPrefixes{Public: 24, Private: 24, Isolated: 26}
+	for azCount := 1; azCount < maxAzCount; azCount++ {
+		before, err := planSubnets("10.0.0.0/16", prefixes, azCount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := planSubnets("10.0.0.0/16", prefixes, azCount+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for tier, cidrs := range map[string][2][]string{
+			"public":   {before.Public, after.Public},
+			"private":  {before.Private, after.Private},
+			"isolated": {before.Isolated, after.Isolated},
+		} {
+			if !reflect.DeepEqual(cidrs[1][:azCount], cidrs[0]) {
+				t.Errorf("az-count %d to %d moved the %s subnets from %v to %v", azCount, azCount+1, tier, cidrs[0], cidrs[1])
+			}
+		}
+	}
+}
+
+func TestIpv6SubnetCidr(t *testing.T) {
+	got, err := ipv6SubnetCidr("2600:1f18:abcd:ef00::/56", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2600:1f18:abcd:ef05::/64"; got != want {
+		t.Errorf("ipv6SubnetCidr() = %s, want %s", got, want)
+	}
+	if _, err := ipv6SubnetCidr("2600:1f18:abcd:ef00::/56", 256); err == nil {
+		t.Error("index 256 of a /56 did not fail")
+	}
+}
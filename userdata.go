@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	b64 "encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"text/template"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+//go:embed templates/*.tmpl
+var userDataFS embed.FS
+
+// userDataTemplates holds every boot script template. Values are inserted
+// with the shell function, which quotes them for bash, and application
+// properties with the property function, which escapes them for
+// application.properties.
+var userDataTemplates = template.Must(template.New("").
+	Funcs(template.FuncMap{"shell": shellQuote, "property": propertyLine}).
+	Option("missingkey=error").
+	ParseFS(userDataFS, "templates/*.tmpl"))
+
+// userDataBoundary separates the parts of a multipart document. It is fixed
+// so the rendered user data, and with it the launch template, only changes
+// when its content does.
+const userDataBoundary = "==CSYE6225-USER-DATA=="
+
+// Content types cloud-init understands in a multipart document.
+const (
+	userDataShellScript = "text/x-shellscript"
+	userDataCloudConfig = "text/cloud-config"
+)
+
+// UserDataPart is one part of a multipart cloud-init document.
+type UserDataPart struct {
+	ContentType string
+	Filename    string
+	Content     string
+}
+
+// WebappUserDataArgs are the inputs of the web application boot script.
+type WebappUserDataArgs struct {
+	Region string
+	// Properties are written to application.properties in order.
+	Properties []appProperty
+
+	// DbUrl is the JDBC URL of the database writer.
+	DbUrl pulumi.StringOutput
+	// DbReaderUrl is the JDBC URL read-only queries may use.
+	DbReaderUrl pulumi.StringOutput
+	// DbSecretArn is the secret the password is read from at boot.
+	DbSecretArn pulumi.StringOutput
+	// SnsTopicArn is the topic the application publishes submissions to.
+	SnsTopicArn pulumi.StringOutput
+	// AppService, when set, is restarted with the new password whenever the
+	// secret rotates.
+	AppService string
+}
+
+// webappUserDataValues is WebappUserDataArgs once every output is known.
+type webappUserDataValues struct {
+	Region      string
+	Properties  []appProperty
+	DbUrl       string
+	DbReaderUrl string
+	DbSecretArn string
+	SnsTopicArn string
+	AppService  string
+}
+
+// webappUserData renders the web application user data and returns it base64
+// encoded, as launch templates expect.
+func webappUserData(args WebappUserDataArgs) pulumi.StringOutput {
+	return pulumi.All(args.DbUrl, args.DbReaderUrl, args.DbSecretArn, args.SnsTopicArn).ApplyT(func(v []interface{}) (string, error) {
+		userData, err := renderWebappUserData(webappUserDataValues{
+			Region:      args.Region,
+			Properties:  args.Properties,
+			DbUrl:       v[0].(string),
+			DbReaderUrl: v[1].(string),
+			DbSecretArn: v[2].(string),
+			SnsTopicArn: v[3].(string),
+			AppService:  args.AppService,
+		})
+		if err != nil {
+			return "", err
+		}
+		return b64.StdEncoding.EncodeToString([]byte(userData)), nil
+	}).(pulumi.StringOutput)
+}
+
+// renderWebappUserData renders the multipart web application user data: a
+// cloud-config part writes the helper scripts and units, then the boot
+// script writes application.properties and starts the services.
+func renderWebappUserData(values webappUserDataValues) (string, error) {
+	cloudConfig, err := renderUserDataTemplate("webapp-cloud-config.yaml.tmpl", values)
+	if err != nil {
+		return "", err
+	}
+	script, err := renderUserDataTemplate("webapp-user-data.sh.tmpl", values)
+	if err != nil {
+		return "", err
+	}
+	return renderMultipartUserData([]UserDataPart{
+		{ContentType: userDataCloudConfig, Filename: "cloud-config.yaml", Content: cloudConfig},
+		{ContentType: userDataShellScript, Filename: "webapp-user-data.sh", Content: script},
+	})
+}
+
+// renderUserDataTemplate executes the named template from templates/.
+func renderUserDataTemplate(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := userDataTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("rendering %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// renderMultipartUserData combines parts into a MIME multipart document that
+// cloud-init runs in order.
+func renderMultipartUserData(parts []UserDataPart) (string, error) {
+	if len(parts) == 0 {
+		return "", fmt.Errorf("multipart user data needs at least one part")
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.SetBoundary(userDataBoundary); err != nil {
+		return "", err
+	}
+	for i, part := range parts {
+		if part.ContentType == "" {
+			return "", fmt.Errorf("user data part %d has no content type", i+1)
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.ContentType+`; charset="us-ascii"`)
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Transfer-Encoding", "7bit")
+		if part.Filename != "" {
+			header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", part.Filename))
+		}
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := pw.Write([]byte(part.Content)); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n%s",
+		userDataBoundary, body.String()), nil
+}
+
+// shellQuote quotes s as a single bash word. Nothing inside single quotes is
+// expanded, so only embedded single quotes need escaping.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
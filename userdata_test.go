@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// assertGolden compares got with testdata/name, or rewrites the file when
+// the tests run with -update.
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file; run go test -update to accept:\n%s", name, got)
+	}
+}
+
+func TestWebappUserDataGolden(t *testing.T) {
+	got, err := renderWebappUserData(webappUserDataValues{
+		Region: "us-east-1",
+		Properties: appProperties(&StackConfig{
+			AppEnvironment: appEnvironmentDev,
+			DbEngine:       "mariadb",
+			DbMasterUser:   "csye6225",
+			AppProperties:  map[string]string{"app.banner": "it's $HOME", "app.motd": " a=b: c\nevil=1 café"},
+		}),
+		DbUrl:       "jdbc:mariadb://db.example.internal:3306/csye6225",
+		DbReaderUrl: "jdbc:mariadb:loadbalance://db-replica-1.example.internal:3306,db-replica-2.example.internal:3306/csye6225",
+		DbSecretArn: "arn:aws:secretsmanager:us-east-1:123456789012:secret:rds!db-mock",
+		SnsTopicArn: "arn:aws:sns:us-east-1:123456789012:csye6225-submissions",
+		AppService:  "csye6225",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "webapp-user-data.golden", got)
+}
+
+func TestMultipartUserDataGolden(t *testing.T) {
+	got, err := renderMultipartUserData([]UserDataPart{
+		{ContentType: userDataCloudConfig, Filename: "cloud-config.yaml", Content: "#cloud-config\npackage_update: true\n"},
+		{ContentType: userDataShellScript, Filename: "boot.sh", Content: "#!/bin/bash\necho ready\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "multipart-user-data.golden", got)
+
+	if _, err := renderMultipartUserData(nil); err == nil {
+		t.Error("empty multipart user data did not fail")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"plain":            `'plain'`,
+		"":                 `''`,
+		"it's":             `'it'\''s'`,
+		"$(rm -rf /) `id`": "'$(rm -rf /) `id`'",
+		"a b\nc":           "'a b\nc'",
+	}
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
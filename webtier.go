@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/acm"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/alb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// WebTier is the web application: the instance role, launch template, Auto
+// Scaling group with its scaling alarms, the load balancer with its HTTPS
+// listener, and the DNS record pointing at it.
+type WebTier struct {
+	pulumi.ResourceState
+
+	LaunchTemplate   *ec2.LaunchTemplate
+	AutoScalingGroup *autoscaling.Group
+	LoadBalancer     *lb.LoadBalancer
+
+	AutoScalingGroupName pulumi.StringOutput
+	LoadBalancerDnsName  pulumi.StringOutput
+	Fqdn                 pulumi.StringOutput
+}
+
+// WebTierArgs are the inputs to NewWebTier.
+type WebTierArgs struct {
+	Config *StackConfig
+
+	VpcId            pulumi.StringPtrInput
+	PublicSubnetIds  pulumi.StringArrayInput
+	PrivateSubnetIds pulumi.StringArrayInput
+
+	LoadBalancerSecurityGroupId pulumi.StringInput
+	ApplicationSecurityGroupId  pulumi.StringInput
+
+	// DbEndpoint is the host:port the application connects to.
+	DbEndpoint pulumi.StringOutput
+	// DbReaderEndpoints are the host:port of the read replicas, if any.
+	DbReaderEndpoints pulumi.StringArrayOutput
+	// DbPasswordSecretArn is the secret instances read the database
+	// credentials from at boot.
+	DbPasswordSecretArn pulumi.StringOutput
+
+	// SnsTopicArn is the submissions topic, the only one instances may
+	// publish to. It is written to application.properties, so the topic must
+	// exist before the launch template.
+	SnsTopicArn pulumi.StringOutput
+}
+
+// NewWebTier creates the web application behind an HTTPS load balancer.
+func NewWebTier(ctx *pulumi.Context, name string, args *WebTierArgs, opts ...pulumi.ResourceOption) (*WebTier, error) {
+	webTier := &WebTier{}
+	err := ctx.RegisterComponentResource("csye6225:index:WebTier", name, webTier, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := args.Config
+
+	policyString, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Action": "sts:AssumeRole",
+				"Effect": "Allow",
+				"Sid":    "",
+				"Principal": map[string]interface{}{
+					"Service": "ec2.amazonaws.com",
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defaultPolicy := string(policyString)
+
+	// Create a new IAM role
+	role, err := iam.NewRole(ctx, "cloudwatch-agent-role", &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(defaultPolicy),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("cloudwatch-agent-role"),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the application only publishes submissions to the pipeline's topic
+	_, err = iam.NewRolePolicy(ctx, "sns-publish-policy", &iam.RolePolicyArgs{
+		Role: role.ID(),
+		Policy: args.SnsTopicArn.ApplyT(func(arn string) (string, error) {
+			policy, err := json.Marshal(map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []map[string]interface{}{
+					{
+						"Effect":   "Allow",
+						"Action":   "sns:Publish",
+						"Resource": arn,
+					},
+				},
+			})
+			return string(policy), err
+		}).(pulumi.StringOutput),
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new IAM instance profile
+	instanceProfile, err := iam.NewInstanceProfile(ctx, "cloudwatch-instance-profile", &iam.InstanceProfileArgs{
+		Role: role.Name,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String("cloudwatch-instance-profile"),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// instances fetch the database password from Secrets Manager at boot
+	_, err = iam.NewRolePolicy(ctx, "db-password-secret-read-policy", &iam.RolePolicyArgs{
+		Role: role.ID(),
+		Policy: args.DbPasswordSecretArn.ApplyT(func(arn string) (string, error) {
+			policy, err := json.Marshal(map[string]interface{}{
+				"Version": "2012-10-17",
+				"Statement": []map[string]interface{}{
+					{
+						"Effect":   "Allow",
+						"Action":   "secretsmanager:GetSecretValue",
+						"Resource": arn,
+					},
+				},
+			})
+			return string(policy), err
+		}).(pulumi.StringOutput),
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attach the policy to the cloudwatch role
+	_, err = iam.NewRolePolicyAttachment(ctx, "cloudwatch-agent-policy", &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/CloudWatchAgentServerPolicy"),
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AccessMode == accessModeSsm {
+		if err := newSessionManagerAccess(ctx, cfg, role, webTier); err != nil {
+			return nil, err
+		}
+	}
+
+	region, err := aws.GetRegion(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// only a managed password rotates under running instances
+	appService := ""
+	if cfg.DbPasswordMode == dbPasswordModeManaged {
+		appService = cfg.AppService
+	}
+
+	// define the launch template
+	launchTemplateArgs := &ec2.LaunchTemplateArgs{
+		Name:                  pulumi.String("webapp-launch-template"),
+		ImageId:               pulumi.String(cfg.AmiId),
+		InstanceType:          pulumi.String(cfg.Ec2InstanceType),
+		DisableApiTermination: pulumi.Bool(false),
+		IamInstanceProfile: &ec2.LaunchTemplateIamInstanceProfileArgs{
+			Name: instanceProfile.Name,
+		},
+		VpcSecurityGroupIds: pulumi.StringArray{args.ApplicationSecurityGroupId},
+		UserData: webappUserData(WebappUserDataArgs{
+			Region:     region.Name,
+			Properties: appProperties(cfg),
+			DbUrl: args.DbEndpoint.ApplyT(func(endpoint string) string {
+				return jdbcUrl(cfg.DbEngine, endpoint, cfg.DbName)
+			}).(pulumi.StringOutput),
+			// without readers, reads go to the writer
+			DbReaderUrl: pulumi.All(args.DbEndpoint, args.DbReaderEndpoints).ApplyT(func(v []interface{}) string {
+				readers := v[1].([]string)
+				if len(readers) == 0 {
+					readers = []string{v[0].(string)}
+				}
+				return readerJdbcUrl(cfg.DbEngine, readers, cfg.DbName)
+			}).(pulumi.StringOutput),
+			DbSecretArn: args.DbPasswordSecretArn,
+			SnsTopicArn: args.SnsTopicArn,
+			AppService:  appService,
+		}),
+	}
+	// with Session Manager the instances have no key pair
+	if cfg.SshKey != "" {
+		launchTemplateArgs.KeyName = pulumi.String(cfg.SshKey)
+	}
+	launchTemplate, err := ec2.NewLaunchTemplate(ctx, "webapp-launch-template", launchTemplateArgs, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a Target Group for our Autoscaling Group
+	targetGroup, err := alb.NewTargetGroup(ctx, "alb-target-group", &alb.TargetGroupArgs{
+		Port:       pulumi.Int(8080),
+		Protocol:   pulumi.String("HTTP"),
+		TargetType: pulumi.String("instance"),
+		VpcId:      args.VpcId,
+		HealthCheck: &alb.TargetGroupHealthCheckArgs{
+			HealthyThreshold:   pulumi.Int(2),
+			Interval:           pulumi.Int(6),
+			Path:               pulumi.String("/healthz"),
+			Port:               pulumi.String("8080"),
+			Protocol:           pulumi.String("HTTP"),
+			Timeout:            pulumi.Int(5),
+			UnhealthyThreshold: pulumi.Int(3),
+		},
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("alb-target-group"),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// instances only sit in the public subnets when explicitly configured;
+	// the load balancer always stays public
+	appSubnetIDs := args.PublicSubnetIds
+	if cfg.AppSubnetTier == appSubnetTierPrivate {
+		appSubnetIDs = args.PrivateSubnetIds
+	}
+
+	// define the autoscaling group
+	asg, err := autoscaling.NewGroup(ctx, "auto-scaling-group", &autoscaling.GroupArgs{
+		Name:               pulumi.String("webapp-auto-scaling-group"),
+		DesiredCapacity:    pulumi.Int(1),
+		MaxSize:            pulumi.Int(3),
+		MinSize:            pulumi.Int(1),
+		DefaultCooldown:    pulumi.Int(60),
+		VpcZoneIdentifiers: appSubnetIDs,
+		TargetGroupArns: pulumi.StringArray{
+			targetGroup.Arn,
+		},
+		LaunchTemplate: &autoscaling.GroupLaunchTemplateArgs{
+			Id:      launchTemplate.ID(),
+			Version: pulumi.String("$Latest"),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a tag and attach it to the AutoScaling Group
+	_, _ = autoscaling.NewTag(ctx, "auto-scaling-group-tag", &autoscaling.TagArgs{
+		AutoscalingGroupName: asg.Name, // reference to the previously created AutoScalingGroup
+		Tag: autoscaling.TagTagArgs{
+			Key:               pulumi.String("Name"),
+			Value:             pulumi.String("webapp"),
+			PropagateAtLaunch: pulumi.Bool(true),
+		},
+	}, childOptions(webTier)...)
+
+	// scale up policy
+	scaleUpPolicy, err := autoscaling.NewPolicy(ctx, "scale-up-policy", &autoscaling.PolicyArgs{
+		ScalingAdjustment:     pulumi.Int(1),
+		AdjustmentType:        pulumi.String("ChangeInCapacity"),
+		MetricAggregationType: pulumi.String("Average"),
+		Cooldown:              pulumi.Int(60),
+		AutoscalingGroupName:  asg.Name,
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+	scaleDownPolicy, err := autoscaling.NewPolicy(ctx, "scale-down-policy", &autoscaling.PolicyArgs{
+		ScalingAdjustment:     pulumi.Int(-1),
+		AdjustmentType:        pulumi.String("ChangeInCapacity"),
+		MetricAggregationType: pulumi.String("Average"),
+		Cooldown:              pulumi.Int(60),
+		AutoscalingGroupName:  asg.Name,
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = cloudwatch.NewMetricAlarm(ctx, "scale-up-alarm", &cloudwatch.MetricAlarmArgs{
+		AlarmActions:       pulumi.Array{scaleUpPolicy.Arn},
+		Dimensions:         pulumi.StringMap{"AutoScalingGroupName": asg.Name},
+		AlarmDescription:   pulumi.String("This metric triggers when the CPU usage exceeds 5%"),
+		ComparisonOperator: pulumi.String("GreaterThanOrEqualToThreshold"),
+		EvaluationPeriods:  pulumi.Int(2),
+		MetricName:         pulumi.String("CPUUtilization"),
+		Namespace:          pulumi.String("AWS/EC2"),
+		Period:             pulumi.Int(60),
+		Statistic:          pulumi.String("Average"),
+		Threshold:          pulumi.Float64(5.0),
+		Tags:               pulumi.StringMap{"Name": pulumi.String("scale-up-alarm")},
+	}, childOptions(webTier)...)
+
+	_, _ = cloudwatch.NewMetricAlarm(ctx, "scale-down-alarm", &cloudwatch.MetricAlarmArgs{
+		AlarmActions:       pulumi.Array{scaleDownPolicy.Arn},
+		Dimensions:         pulumi.StringMap{"AutoScalingGroupName": asg.Name},
+		AlarmDescription:   pulumi.String("This metric triggers when the CPU usage goes below 3%"),
+		ComparisonOperator: pulumi.String("LessThanOrEqualToThreshold"),
+		EvaluationPeriods:  pulumi.Int(2),
+		MetricName:         pulumi.String("CPUUtilization"),
+		Namespace:          pulumi.String("AWS/EC2"),
+		Period:             pulumi.Int(60),
+		Statistic:          pulumi.String("Average"),
+		Threshold:          pulumi.Float64(3.0),
+		Tags:               pulumi.StringMap{"Name": pulumi.String("scale-down-alarm")},
+	}, childOptions(webTier)...)
+
+	albIpAddressType := "ipv4"
+	if cfg.EnableIpv6 {
+		albIpAddressType = "dualstack"
+	}
+
+	loadBalancer, err := lb.NewLoadBalancer(ctx, "load-balancer", &lb.LoadBalancerArgs{
+		Internal:         pulumi.Bool(false),
+		LoadBalancerType: pulumi.String("application"),
+		IpAddressType:    pulumi.String(albIpAddressType),
+		SecurityGroups: pulumi.StringArray{
+			args.LoadBalancerSecurityGroupId,
+		},
+		Subnets: args.PublicSubnetIds,
+		Tags: pulumi.StringMap{
+			"course": courseTag,
+			"assign": assignmentTag,
+			"Name":   pulumi.String("load-balancer"),
+		},
+	}, childOptions(webTier)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ssl_certificate, err := acm.LookupCertificate(ctx, &acm.LookupCertificateArgs{
+		Domain: cfg.DomainName,
+		Statuses: []string{
+			"ISSUED",
+		},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = alb.NewListener(ctx, "HTTPS listener", &alb.ListenerArgs{
+		DefaultActions: alb.ListenerDefaultActionArray{
+			alb.ListenerDefaultActionArgs{
+				Type:           pulumi.String("forward"),
+				TargetGroupArn: targetGroup.Arn,
+			},
+		},
+		LoadBalancerArn: loadBalancer.Arn,
+		CertificateArn:  pulumi.String(ssl_certificate.Arn),
+		Port:            pulumi.Int(443),
+		Protocol:        pulumi.String("HTTPS"),
+	}, childOptions(webTier, pulumi.DependsOn([]pulumi.Resource{loadBalancer}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	zoneID, err := route53.LookupZone(ctx, &route53.LookupZoneArgs{
+		Name: pulumi.StringRef(cfg.DomainName),
+	}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+	// Create a new A Record for the load balancer
+	record, err := route53.NewRecord(ctx, "New-A-record", &route53.RecordArgs{
+		Name:   pulumi.String(cfg.DomainName),
+		Type:   pulumi.String("A"),
+		ZoneId: pulumi.String(zoneID.Id),
+		Aliases: route53.RecordAliasArray{
+			&route53.RecordAliasArgs{
+				Name:                 loadBalancer.DnsName,
+				ZoneId:               loadBalancer.ZoneId,
+				EvaluateTargetHealth: pulumi.Bool(true),
+			},
+		},
+		AllowOverwrite: pulumi.Bool(true),
+	}, childOptions(webTier, pulumi.DependsOn([]pulumi.Resource{asg}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	webTier.LaunchTemplate = launchTemplate
+	webTier.AutoScalingGroup = asg
+	webTier.LoadBalancer = loadBalancer
+	webTier.AutoScalingGroupName = asg.Name
+	webTier.LoadBalancerDnsName = loadBalancer.DnsName
+	webTier.Fqdn = record.Fqdn
+
+	err = ctx.RegisterResourceOutputs(webTier, pulumi.Map{
+		"autoScalingGroupName": webTier.AutoScalingGroupName,
+		"loadBalancerDnsName":  webTier.LoadBalancerDnsName,
+		"fqdn":                 webTier.Fqdn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webTier, nil
+}
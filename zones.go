@@ -0,0 +1,49 @@
+package main
+
+import "fmt"
+
+// selectZones picks the availability zones subnets are created in. When names
+// or ids are given they are used as-is (ids are translated to zone names),
+// otherwise the first count zones the region reports are used. It fails if
+// the region cannot satisfy the request.
+func selectZones(availableNames, availableIds []string, count int, names, ids []string) ([]string, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("az-count must be at least 1, got %d", count)
+	}
+
+	var zones []string
+	switch {
+	case len(names) > 0:
+		known := map[string]bool{}
+		for _, name := range availableNames {
+			known[name] = true
+		}
+		for _, name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("availability zone %q is not available in this region (available: %v)", name, availableNames)
+			}
+		}
+		zones = names
+	case len(ids) > 0:
+		byId := map[string]string{}
+		for i, id := range availableIds {
+			if i < len(availableNames) {
+				byId[id] = availableNames[i]
+			}
+		}
+		for _, id := range ids {
+			name, ok := byId[id]
+			if !ok {
+				return nil, fmt.Errorf("availability zone id %q is not available in this region (available: %v)", id, availableIds)
+			}
+			zones = append(zones, name)
+		}
+	default:
+		zones = availableNames
+	}
+
+	if len(zones) < count {
+		return nil, fmt.Errorf("az-count is %d but only %d availability zones can be used: %v", count, len(zones), zones)
+	}
+	return zones[:count], nil
+}